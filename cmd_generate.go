@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/matryer/remoto/generator"
 	"github.com/spf13/cobra"
@@ -13,6 +14,7 @@ import (
 
 func init() {
 	var outputFile string
+	var values []string
 	var generateCmd = &cobra.Command{
 		Use:   "generate definition-folder template",
 		Short: "Generate source code from a template and remoto definition.",
@@ -50,12 +52,22 @@ func init() {
 				fmt.Fprintf(os.Stderr, "template: %v\n", err)
 				os.Exit(1)
 			}
-			if err := generator.Render(o, template, string(b), def); err != nil {
+			templateValues := make(map[string]interface{})
+			for _, value := range values {
+				segs := strings.SplitN(value, "=", 2)
+				if len(segs) != 2 {
+					fmt.Fprintf(os.Stderr, "set: expected key=value: %s\n", value)
+					os.Exit(1)
+				}
+				templateValues[segs[0]] = segs[1]
+			}
+			if err := generator.RenderWithValues(o, template, string(b), def, templateValues); err != nil {
 				fmt.Fprintf(os.Stderr, "render template: %v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
 	generateCmd.Flags().StringVarP(&outputFile, "output", "o", "", "output file (default stdout)")
+	generateCmd.Flags().StringArrayVar(&values, "set", nil, "template value as key=value (may be repeated)")
 	rootCmd.AddCommand(generateCmd)
 }
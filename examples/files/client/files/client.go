@@ -3,6 +3,7 @@
 package files
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
@@ -10,9 +11,11 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
-	"github.com/matryer/remoto/remototypes"
-	"github.com/oxtoacart/bpool"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
 	"github.com/pkg/errors"
 )
 
@@ -22,8 +25,15 @@ type ImagesClient struct {
 	endpoint string
 	// httpclient is the http.Client to use to make requests.
 	httpclient *http.Client
-	// bufs is a buffer pool
-	bufs *bpool.BufferPool
+
+	// Codec encodes requests and decodes responses, e.g.
+	// remotohttp.MessagePack. By default (nil), JSON is used.
+	// Streamed responses, and requests with files, are always JSON.
+	Codec remotohttp.Codec
+	// Compress is whether to gzip request bodies of at least
+	// remotohttp.DefaultCompressMinBytes. Compressed responses are
+	// decompressed by the http.Transport.
+	Compress bool
 }
 
 // NewImagesClient makes a new ImagesClient that will
@@ -32,52 +42,48 @@ func NewImagesClient(endpoint string, client *http.Client) *ImagesClient {
 	return &ImagesClient{
 		endpoint:   endpoint,
 		httpclient: client,
-		bufs:       bpool.NewBufferPool(48),
 	}
 }
 
-func (c *ImagesClient) Flip(ctx context.Context, request *FlipRequest) (io.ReadCloser, error) {
-	b, err := json.Marshal([]interface{}{request})
-	if err != nil {
-		return nil, errors.Wrap(err, "ImagesClient.Flip: encode request")
+// codec gets the Codec to use.
+func (c *ImagesClient) codec() remotohttp.Codec {
+	if c.Codec == nil {
+		return remotohttp.JSON
 	}
-	buf := c.bufs.Get()
-	defer c.bufs.Put(buf)
-	w := multipart.NewWriter(buf)
-	w.WriteField("json", string(b))
-	if files, ok := ctx.Value(contextKeyFiles).(map[string]file); ok {
-		for fieldname, file := range files {
-			f, err := w.CreateFormFile(fieldname, file.filename)
-			if err != nil {
-				return nil, errors.Wrap(err, "ImagesClient.Flip: create form file")
-			}
-			if _, err := io.Copy(f, file.r); err != nil {
-				return nil, errors.Wrap(err, "ImagesClient.Flip: reading file")
-			}
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			default:
-			}
+	return c.Codec
+}
+
+func (c *ImagesClient) Flip(ctx context.Context, request *FlipRequest) (io.ReadCloser, error) {
+	var files []file
+	if request != nil {
+		for _, file := range request.files {
+			files = append(files, file)
 		}
 	}
-	if err := w.Close(); err != nil {
-		return nil, errors.Wrap(err, "ImagesClient.Flip: write")
+	body, contentType, err := newBody([]*FlipRequest{request}, files, remotohttp.JSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "ImagesClient.Flip: encode request")
 	}
-	req, err := http.NewRequest(http.MethodPost, c.endpoint+"/remoto/Images.Flip", buf)
+	req, err := http.NewRequest(http.MethodPost, c.endpoint+"/remoto/Images.Flip", body)
 	if err != nil {
 		return nil, errors.Wrap(err, "ImagesClient.Flip: new request")
 	}
+	if c.Compress {
+		if err := remotohttp.CompressRequest(req, remotohttp.DefaultCompressMinBytes); err != nil {
+			return nil, errors.Wrap(err, "ImagesClient.Flip")
+		}
+	}
 	req.Header.Set("Accept", "application/json; charset=utf-8")
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Content-Type", contentType)
 	req = req.WithContext(ctx)
 	resp, err := c.httpclient.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "ImagesClient.Flip: do")
 	}
-	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, errors.Errorf("ImagesClient.Flip: remote service returned %s", resp.Status)
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		// errors are returned as JSON rather than a file
+		defer resp.Body.Close()
+		return nil, errors.Wrap(remotohttp.ResponseErr(resp), "ImagesClient.Flip")
 	}
 	return resp.Body, nil
 }
@@ -85,40 +91,83 @@ func (c *ImagesClient) Flip(ctx context.Context, request *FlipRequest) (io.ReadC
 // FlipRequest is the request for Images.Flip.
 type FlipRequest struct {
 	Image remototypes.File `json:"image"`
+
+	// files are the files to upload with the request, keyed by
+	// field name.
+	files map[string]file
 }
 
-// SetImage sets the file for the Image field.
-func (s *FlipRequest) SetImage(ctx context.Context, filename string, r io.Reader) context.Context {
-	files, ok := ctx.Value(contextKeyFiles).(map[string]file)
-	if !ok {
-		files = make(map[string]file)
+// SetImage sets the file to upload for the Image field.
+// The file is read from r when the request is made.
+func (s *FlipRequest) SetImage(filename string, r io.Reader) {
+	fieldname := nextFieldname()
+	if s.files == nil {
+		s.files = make(map[string]file)
 	}
-	fieldname := "files[" + strconv.Itoa(len(files)) + "]"
-	files[fieldname] = file{r: r, filename: filename}
-	ctx = context.WithValue(ctx, contextKeyFiles, files)
+	s.files["Image"] = file{fieldname: fieldname, filename: filename, r: r}
 	s.Image = remototypes.File{
 		Fieldname: fieldname,
 		Filename:  filename,
 	}
-	return ctx
 }
 
-// contextKey is a local context key type.
-// see https://medium.com/@matryer/context-keys-in-go-5312346a868d
-type contextKey string
+// file is a file to upload, including the io.Reader where the
+// contents will be read from.
+type file struct {
+	fieldname string
+	filename  string
+	r         io.Reader
+}
+
+// fileCount is the number of files that have been set, and is used
+// to generate unique field names.
+var fileCount uint64
 
-func (c contextKey) String() string {
-	return "remoto context key: " + string(c)
+// nextFieldname gets a unique field name for a file.
+func nextFieldname() string {
+	return "files[" + strconv.FormatUint(atomic.AddUint64(&fileCount, 1), 10) + "]"
 }
 
-// contextKeyFiles is the context key for the request files.
-var contextKeyFiles = contextKey("files")
+// newBody gets the body and Content-Type for a request.
+// Requests with files are streamed as multipart/form-data, with the
+// requests as JSON, otherwise they are encoded with the codec.
+func newBody(requests interface{}, files []file, codec remotohttp.Codec) (io.Reader, string, error) {
+	if len(files) == 0 {
+		b, err := codec.Marshal(requests)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(b), codec.ContentType(), nil
+	}
+	b, err := json.Marshal(requests)
+	if err != nil {
+		return nil, "", err
+	}
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	go func() {
+		// the http.Client closes the body if the request fails, which
+		// stops this early
+		pw.CloseWithError(writeMultipart(w, b, files))
+	}()
+	return pr, w.FormDataContentType(), nil
+}
 
-// file holds info about a file in the context, including
-// the io.Reader where the contents will be read from.
-type file struct {
-	r        io.Reader
-	filename string
+// writeMultipart writes the requests, as the json field, and the files.
+func writeMultipart(w *multipart.Writer, requests []byte, files []file) error {
+	if err := w.WriteField("json", string(requests)); err != nil {
+		return err
+	}
+	for _, file := range files {
+		f, err := w.CreateFormFile(file.fieldname, file.filename)
+		if err != nil {
+			return errors.Wrap(err, "create form file")
+		}
+		if _, err := io.Copy(f, file.r); err != nil {
+			return errors.Wrap(err, "reading file")
+		}
+	}
+	return w.Close()
 }
 
 // this is here so we don't get a compiler complaints.
@@ -126,4 +175,6 @@ func init() {
 	var _ = remototypes.File{}
 	var _ = strconv.Itoa(0)
 	var _ = ioutil.Discard
+	var _ = strings.HasPrefix
+	var _ = remotohttp.ErrorResponse{}
 }
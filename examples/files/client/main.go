@@ -49,7 +49,7 @@ func run() error {
 	defer f.Close()
 	images := files.NewImagesClient("http://localhost:8080", http.DefaultClient)
 	request := &files.FlipRequest{}
-	ctx = request.SetImage(ctx, filepath.Base(inputFile), f)
+	request.SetImage(filepath.Base(inputFile), f)
 	resp, err := images.Flip(ctx, request)
 	if err != nil {
 		return errors.Wrap(err, "images.Flip")
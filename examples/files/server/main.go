@@ -49,7 +49,7 @@ func (service) Flip(ctx context.Context, req *files.FlipRequest) (*remototypes.F
 	}
 	resp := &remototypes.FileResponse{
 		Filename:      "flipped.jpg",
-		Data:          &buf,
+		Data:          bytes.NewReader(buf.Bytes()),
 		ContentLength: buf.Len(),
 		ContentType:   "image/jpeg",
 	}
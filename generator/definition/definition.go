@@ -92,11 +92,18 @@ type Method struct {
 	Comment           string    `json:"comment"`
 	RequestStructure  Structure `json:"requestStructure"`
 	ResponseStructure Structure `json:"responseStructure"`
+	// IsStreaming is whether the method returns a stream of responses,
+	// declared with a <-chan Response return type.
+	IsStreaming bool `json:"isStreaming"`
 }
 
 func (m Method) String() string {
 	str := printComments(m.Comment)
-	str += m.Name + "(" + m.RequestStructure.Name + ") " + m.ResponseStructure.Name
+	str += m.Name + "(" + m.RequestStructure.Name + ") "
+	if m.IsStreaming {
+		str += "<-chan "
+	}
+	str += m.ResponseStructure.Name
 	return str
 }
 
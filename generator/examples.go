@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/matryer/remoto/generator/definition"
+)
+
+// ExampleFile describes a file that is uploaded in an example request.
+type ExampleFile struct {
+	// Fieldname is the name of the form field, e.g. files[0].
+	Fieldname string
+	// Filename is the example filename.
+	Filename string
+}
+
+// exampleJSON synthesizes an example JSON request body (an array
+// containing one object) for the structure, using the field types
+// and any "Example:" lines in the field comments.
+// Use example_json(def, structure) in templates.
+func exampleJSON(def definition.Definition, structure definition.Structure) string {
+	e := &exampler{def: def}
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	e.writeStructure(&buf, structure, 0)
+	buf.WriteString("]")
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return buf.String()
+	}
+	return out.String()
+}
+
+// exampleFiles gets the files that would be uploaded with the example
+// request from exampleJSON.
+// Use example_files(def, structure) in templates.
+func exampleFiles(def definition.Definition, structure definition.Structure) []ExampleFile {
+	e := &exampler{def: def}
+	var buf bytes.Buffer
+	e.writeStructure(&buf, structure, 0)
+	return e.files
+}
+
+// shellQuote quotes s so it can be safely used as a single argument
+// in a POSIX shell.
+// Use shell_quote(s) in templates.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// maxExampleDepth is how deep nested structures will be described
+// before giving up, preventing recursive types from looping forever.
+const maxExampleDepth = 8
+
+// exampler synthesizes example values.
+type exampler struct {
+	def   definition.Definition
+	files []ExampleFile
+}
+
+func (e *exampler) writeStructure(buf *bytes.Buffer, structure definition.Structure, depth int) {
+	buf.WriteString("{")
+	if depth > maxExampleDepth {
+		buf.WriteString("}")
+		return
+	}
+	first := true
+	for _, field := range structure.Fields {
+		if structure.IsResponseObject && isDefaultResponseField(field.Name) {
+			continue
+		}
+		if !first {
+			buf.WriteString(",")
+		}
+		first = false
+		buf.WriteString(strconv.Quote(underscore(field.Name)) + ":")
+		if field.Type.IsMultiple {
+			buf.WriteString("[")
+		}
+		e.writeValue(buf, field, depth)
+		if field.Type.IsMultiple {
+			buf.WriteString("]")
+		}
+	}
+	buf.WriteString("}")
+}
+
+func (e *exampler) writeValue(buf *bytes.Buffer, field definition.Field, depth int) {
+	if example, ok := commentExample(field.Comment); ok {
+		buf.WriteString(example)
+		return
+	}
+	switch field.Type.Name {
+	case "string":
+		buf.WriteString(strconv.Quote(underscore(field.Name)))
+	case "int":
+		buf.WriteString("0")
+	case "float64":
+		buf.WriteString("0.0")
+	case "bool":
+		buf.WriteString("false")
+	case "remototypes.File":
+		file := ExampleFile{
+			Fieldname: "files[" + strconv.Itoa(len(e.files)) + "]",
+			Filename:  underscore(field.Name) + ".bin",
+		}
+		e.files = append(e.files, file)
+		b, _ := json.Marshal(struct {
+			Fieldname string `json:"fieldname"`
+			Filename  string `json:"filename"`
+		}{file.Fieldname, file.Filename})
+		buf.Write(b)
+	default:
+		structure := e.def.Structure(field.Type.Name)
+		if structure == nil {
+			buf.WriteString("null")
+			return
+		}
+		e.writeStructure(buf, *structure, depth+1)
+	}
+}
+
+// commentExample gets the value from an "Example: value" line in
+// the comment, as JSON. Values that are not valid JSON are treated
+// as strings.
+func commentExample(comment string) (string, bool) {
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(strings.ToLower(line), "example:") {
+			continue
+		}
+		value := strings.TrimSpace(line[len("example:"):])
+		if json.Valid([]byte(value)) {
+			return value, true
+		}
+		return strconv.Quote(value), true
+	}
+	return "", false
+}
@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/generator/definition"
+)
+
+func TestExampleJSON(t *testing.T) {
+	is := is.New(t)
+	photo := definition.Structure{
+		Name: "Photo",
+		Fields: []definition.Field{
+			{Name: "Image", Type: definition.Type{Name: "remototypes.File"}},
+			{Name: "Caption", Type: definition.Type{Name: "string"}, Comment: "Caption is a quip.\nExample: Nice cat"},
+		},
+	}
+	request := definition.Structure{
+		Name:            "SubmitRequest",
+		IsRequestObject: true,
+		Fields: []definition.Field{
+			{Name: "ModelID", Type: definition.Type{Name: "string"}},
+			{Name: "Limit", Type: definition.Type{Name: "int"}, Comment: "Example: 10"},
+			{Name: "Threshold", Type: definition.Type{Name: "float64"}},
+			{Name: "Tags", Type: definition.Type{Name: "string", IsMultiple: true}, Comment: `Example: "cats"`},
+			{Name: "Public", Type: definition.Type{Name: "bool"}},
+			{Name: "Photos", Type: definition.Type{Name: "Photo", IsStruct: true, IsMultiple: true}},
+			{Name: "Cover", Type: definition.Type{Name: "Photo", IsStruct: true}},
+		},
+	}
+	def := definition.Definition{
+		Services: []definition.Service{
+			{Structures: []definition.Structure{request, photo}},
+		},
+	}
+	is.Equal(exampleJSON(def, request), `[
+  {
+    "model_id": "model_id",
+    "limit": 10,
+    "threshold": 0.0,
+    "tags": [
+      "cats"
+    ],
+    "public": false,
+    "photos": [
+      {
+        "image": {
+          "fieldname": "files[0]",
+          "filename": "image.bin"
+        },
+        "caption": "Nice cat"
+      }
+    ],
+    "cover": {
+      "image": {
+        "fieldname": "files[1]",
+        "filename": "image.bin"
+      },
+      "caption": "Nice cat"
+    }
+  }
+]`)
+	files := exampleFiles(def, request)
+	is.Equal(len(files), 2)
+	is.Equal(files[0].Fieldname, "files[0]")
+	is.Equal(files[1].Fieldname, "files[1]")
+	is.Equal(files[1].Filename, "image.bin")
+}
+
+func TestExampleJSONRecursive(t *testing.T) {
+	is := is.New(t)
+	node := definition.Structure{
+		Name: "Node",
+		Fields: []definition.Field{
+			{Name: "Child", Type: definition.Type{Name: "Node", IsStruct: true}},
+		},
+	}
+	def := definition.Definition{
+		Services: []definition.Service{
+			{Structures: []definition.Structure{node}},
+		},
+	}
+	is.True(len(exampleJSON(def, node)) > 0) // must terminate
+}
+
+func TestShellQuote(t *testing.T) {
+	is := is.New(t)
+	is.Equal(shellQuote(`hello`), `'hello'`)
+	is.Equal(shellQuote(`it's`), `'it'\''s'`)
+}
@@ -172,6 +172,14 @@ func parseMethod(fset *token.FileSet, docs *doc.Package, docstype *doc.Type, pkg
 		return method, newErr(fset, m.Pos(), "service methods must have signature (*Request) *Response")
 	}
 	responseParam := returns.At(0)
+	if ch, ok := responseParam.Type().(*types.Chan); ok {
+		// <-chan Response is a streaming method
+		if ch.Dir() != types.RecvOnly {
+			return method, newErr(fset, m.Pos(), "streaming methods must return a receive-only channel (<-chan Response)")
+		}
+		method.IsStreaming = true
+		responseParam = types.NewVar(responseParam.Pos(), responseParam.Pkg(), responseParam.Name(), ch.Elem())
+	}
 	responseStructure, err := parseStructureFromParam(fset, docs, pkg, def, srv, "response", responseParam)
 	if err != nil {
 		return method, err
@@ -179,29 +187,92 @@ func parseMethod(fset *token.FileSet, docs *doc.Package, docstype *doc.Type, pkg
 	if requestStructure.Name == responseStructure.Name {
 		return method, newErr(fset, m.Pos(), "service methods must use different types for request and response objects")
 	}
+	if method.IsStreaming && responseStructure.Name == "remototypes.FileResponse" {
+		return method, newErr(fset, m.Pos(), "streaming methods cannot return files")
+	}
 	responseStructure.IsResponseObject = true
 	if !strings.HasSuffix(responseStructure.Name, "Response") {
 		return method, newErr(fset, m.Pos(), "response object type name should end with \"Response\"")
 	}
+	if field := nestedFileField(srv, responseStructure, make(map[string]bool)); field != "" {
+		return method, newErr(fset, m.Pos(), "field "+field+": files can only be returned in the fields of the response object, not in nested structures")
+	}
 	addDefaultResponseFields(&responseStructure)
 	method.ResponseStructure = responseStructure
 	srv.EnsureStructure(responseStructure)
 	return method, nil
 }
 
+// nestedFileField gets the name of a remototypes.File field, like
+// "Face.Image", in the structures nested in the structure, or an empty
+// string if there is none. Files attached to responses are only opened
+// from the fields of the response object itself.
+func nestedFileField(srv *definition.Service, structure definition.Structure, seen map[string]bool) string {
+	for _, field := range structure.Fields {
+		if !field.Type.IsStruct || field.Type.IsImported || seen[field.Type.Name] {
+			continue
+		}
+		seen[field.Type.Name] = true
+		for _, nested := range srv.Structures {
+			if nested.Name != field.Type.Name {
+				continue
+			}
+			if files := nested.FieldsOfType("remototypes.File"); len(files) > 0 {
+				return nested.Name + "." + files[0].Name
+			}
+			if name := nestedFileField(srv, nested, seen); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// defaultResponseFields are the built-in remoto fields that are added
+// to every response structure, describing any error that occurred.
+var defaultResponseFields = []definition.Field{
+	{
+		Comment: "Error is an error message if one occurred.",
+		Name:    "Error",
+		Type:    definition.Type{Name: "string"},
+	},
+	{
+		Comment: "ErrorCode is a machine readable code describing the error, if one occurred.",
+		Name:    "ErrorCode",
+		Type:    definition.Type{Name: "string"},
+	},
+	{
+		Comment: "ErrorDetails are additional details about the error.",
+		Name:    "ErrorDetails",
+		Type:    definition.Type{Name: "string", IsMultiple: true},
+	},
+	{
+		Comment: "ErrorRetryable is whether the request may succeed if it is retried.",
+		Name:    "ErrorRetryable",
+		Type:    definition.Type{Name: "bool"},
+	},
+}
+
 // addDefaultResponseFields adds the built-in remoto fields to the
 // response structure.
 func addDefaultResponseFields(structure *definition.Structure) {
-	if structure.HasField("Error") {
-		return
+	for _, field := range defaultResponseFields {
+		if structure.HasField(field.Name) {
+			continue
+		}
+		structure.Fields = append(structure.Fields, field)
 	}
-	structure.Fields = append(structure.Fields, definition.Field{
-		Comment: "Error is an error message if one occurred.",
-		Name:    "Error",
-		Type: definition.Type{
-			Name: "string",
-		},
-	})
+}
+
+// isDefaultResponseField gets whether the named field is one of the
+// built-in remoto response fields.
+func isDefaultResponseField(name string) bool {
+	for _, field := range defaultResponseFields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func parseStructureFromParam(fset *token.FileSet, docs *doc.Package, pkg *types.Package, def *definition.Definition, srv *definition.Service, structureKind string, v *types.Var) (definition.Structure, error) {
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/matryer/is"
+	"github.com/matryer/remoto/generator/definition"
 )
 
 func TestParser(t *testing.T) {
@@ -88,6 +89,12 @@ type GreetResponse struct {
 	Greeting string
 	// Error is an error message if one occurred.
 	Error string
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool
 }
 
 // Greeter provides greeting services.
@@ -108,6 +115,12 @@ type GreetResponse struct {
 	Greeting string
 	// Error is an error message if one occurred.
 	Error string
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool
 }
 
 `)
@@ -191,6 +204,12 @@ type GreetResponse struct {
 	Greeting string
 	// Error is an error message if one occurred.
 	Error string
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool
 }
 
 // Greeter provides greeting services.
@@ -211,6 +230,12 @@ type GreetResponse struct {
 	Greeting string
 	// Error is an error message if one occurred.
 	Error string
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool
 }
 
 `)
@@ -231,6 +256,7 @@ func TestErrors(t *testing.T) {
 		"testdata/rpc/errors/unexported-methods":          "greeter.remoto.go:6:2: method greet: must be exported",
 		"testdata/rpc/errors/same-request-response-types": "greeter.remoto.go:7:2: service methods must use different types for request and response objects",
 		"testdata/rpc/errors/other-imports":               "import not allowed: context",
+		"testdata/rpc/errors/bidirectional-chan":          "greeter.remoto.go:4:2: streaming methods must return a receive-only channel (<-chan Response)",
 	}
 	pwd, err := os.Getwd()
 	is.NoErr(err)
@@ -312,3 +338,91 @@ type GreetingFormat struct {
 	AllCaps bool
 }
 `
+
+func TestAddDefaultResponseFields(t *testing.T) {
+	is := is.New(t)
+	structure := definition.Structure{
+		Name: "GreetResponse",
+		Fields: []definition.Field{
+			{Name: "Error", Type: definition.Type{Name: "string"}, Comment: "Error is custom."},
+		},
+	}
+	addDefaultResponseFields(&structure)
+	is.Equal(len(structure.Fields), 4)
+	is.Equal(structure.Fields[0].Comment, "Error is custom.") // existing fields are kept
+	is.Equal(structure.Fields[1].Name, "ErrorCode")
+	is.Equal(structure.Fields[2].Name, "ErrorDetails")
+	is.Equal(structure.Fields[2].Type.IsMultiple, true)
+	is.Equal(structure.Fields[3].Name, "ErrorRetryable")
+	is.True(isDefaultResponseField("ErrorCode"))
+	is.True(!isDefaultResponseField("Greeting"))
+}
+
+func TestParserStreaming(t *testing.T) {
+	is := is.New(t)
+	def, err := ParseDir("testdata/rpc/streaming")
+	is.NoErr(err)
+	is.Equal(len(def.Services), 1)
+	method := def.Services[0].Methods[0]
+	is.Equal(method.Name, "Watch")
+	is.Equal(method.IsStreaming, true)
+	is.Equal(method.ResponseStructure.Name, "WatchResponse")
+	is.Equal(method.ResponseStructure.IsResponseObject, true)
+	is.True(strings.Contains(def.String(), "Watch(WatchRequest) <-chan WatchResponse"))
+
+	_, err = Parse(strings.NewReader(`package files
+
+import "github.com/matryer/remoto/remototypes"
+
+type Images interface {
+	Flip(FlipRequest) <-chan remototypes.FileResponse
+}
+
+type FlipRequest struct {
+	Image remototypes.File
+}
+`))
+	is.True(err != nil)
+	is.True(strings.HasSuffix(err.Error(), "streaming methods cannot return files"))
+}
+
+func TestParserResponseFiles(t *testing.T) {
+	is := is.New(t)
+	def, err := ParseDir("testdata/rpc/files")
+	is.NoErr(err)
+	is.Equal(len(def.Services), 1)
+	method := def.Services[0].Methods[0]
+	is.Equal(method.Name, "Make")
+	files := method.ResponseStructure.FieldsOfType("remototypes.File")
+	is.Equal(len(files), 2)
+	is.Equal(files[0].Name, "Original")
+	is.Equal(files[1].Name, "Thumbnails")
+	is.Equal(files[1].Type.IsMultiple, true)
+}
+
+func TestParserNestedResponseFiles(t *testing.T) {
+	is := is.New(t)
+	_, err := Parse(strings.NewReader(`package faces
+
+import "github.com/matryer/remoto/remototypes"
+
+type Faces interface {
+	Detect(DetectRequest) DetectResponse
+}
+
+type DetectRequest struct {
+	Image remototypes.File
+}
+
+type DetectResponse struct {
+	Faces []Face
+}
+
+type Face struct {
+	Name  string
+	Image remototypes.File
+}
+`))
+	is.True(err != nil)
+	is.True(strings.HasSuffix(err.Error(), "field Face.Image: files can only be returned in the fields of the response object, not in nested structures"))
+}
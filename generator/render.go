@@ -10,7 +10,18 @@ import (
 
 // Render renders the tpl template with the Definition into w.
 func Render(w io.Writer, templateName, tpl string, def definition.Definition) error {
+	return RenderWithValues(w, templateName, tpl, def, nil)
+}
+
+// RenderWithValues renders the tpl template with the Definition into w.
+// Each of the values is available in the template by its key, allowing
+// templates to be configured. For example, {"client_package": "..."}
+// may be accessed in a template with <%= client_package %>.
+func RenderWithValues(w io.Writer, templateName, tpl string, def definition.Definition, values map[string]interface{}) error {
 	ctx := plush.NewContext()
+	for k, v := range values {
+		ctx.Set(k, v)
+	}
 	ctx.Set("def", def)
 	AddTemplateHelpers(ctx)
 	out, err := plush.Render(tpl, ctx)
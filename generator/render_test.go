@@ -31,6 +31,9 @@ func TestRender(t *testing.T) {
 		structure: GreetResponse
 			field: Greeting string
 			field: Error string
+			field: ErrorCode string
+			field: ErrorDetails string
+			field: ErrorRetryable bool
 	service: Greeter
 		method: Greet
 			request: GreetRequest
@@ -40,5 +43,21 @@ func TestRender(t *testing.T) {
 		structure: GreetResponse
 			field: Greeting string
 			field: Error string
+			field: ErrorCode string
+			field: ErrorDetails string
+			field: ErrorRetryable bool
 `)
 }
+
+func TestRenderWithValues(t *testing.T) {
+	is := is.New(t)
+	def, err := ParseDir("testdata/rpc/example")
+	is.NoErr(err)
+	var buf bytes.Buffer
+	values := map[string]interface{}{
+		"client_package": "github.com/matryer/remoto/client",
+	}
+	err = RenderWithValues(&buf, "", `<%= def.PackageName %>: <%= client_package %>`, def, values)
+	is.NoErr(err)
+	is.Equal(buf.String(), `greeter: github.com/matryer/remoto/client`)
+}
@@ -1,8 +1,11 @@
 package generator
 
 import (
+	"html/template"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/markbates/inflect"
 	"github.com/matryer/remoto/generator/definition"
@@ -17,9 +20,20 @@ type Setter interface {
 func AddTemplateHelpers(s Setter) {
 	s.Set("unique_structures", uniqueStructures)
 	s.Set("print_comment", printComment)
+	s.Set("print_prefixed_comment", printPrefixedComment)
 	s.Set("go_type_string", goTypeString)
+	s.Set("go_quote", goQuote)
 	s.Set("underscore", underscore)
 	s.Set("camelize_down_first", camelizeDownFirst)
+	s.Set("rust_type_string", rustTypeString)
+	s.Set("rust_field_name", rustFieldName)
+	s.Set("java_type_string", javaTypeString)
+	s.Set("java_field_name", javaFieldName)
+	s.Set("example_json", exampleJSON)
+	s.Set("example_files", exampleFiles)
+	s.Set("shell_quote", shellQuote)
+	s.Set("markdown_anchor", markdownAnchor)
+	s.Set("markdown_cell", markdownCell)
 
 	// experimental (undocumented)
 	s.Set("replace", replace)
@@ -74,6 +88,21 @@ func printComment(comment string) string {
 	return out
 }
 
+// printPrefixedComment prints a comment with each line starting with
+// prefix, unless the comment is empty. Useful for languages with other
+// comment styles, or when the comment should be indented.
+// Use print_prefixed_comment(s, "    /// ") in templates.
+func printPrefixedComment(comment, prefix string) string {
+	if comment == "" {
+		return ""
+	}
+	var out string
+	for _, line := range strings.Split(comment, "\n") {
+		out += prefix + line + "\n"
+	}
+	return out
+}
+
 // goTypeString gets the Type as a Go string.
 // Use go_type_string(type) in templates.
 func goTypeString(typ definition.Type) string {
@@ -83,6 +112,138 @@ func goTypeString(typ definition.Type) string {
 	return typ.Name
 }
 
+// goQuote gets the string as a double-quoted Go string literal.
+// Use go_quote(s) in templates.
+func goQuote(s string) template.HTML {
+	return template.HTML(strconv.Quote(s))
+}
+
+// rustTypeString gets the Type as a Rust string.
+// Use rust_type_string(type) in templates.
+func rustTypeString(typ definition.Type) template.HTML {
+	var name string
+	switch typ.Name {
+	case "string":
+		name = "String"
+	case "float64":
+		name = "f64"
+	case "int":
+		name = "i64"
+	case "bool":
+		name = "bool"
+	case "remototypes.File":
+		name = "File"
+	default:
+		name = typ.Name
+	}
+	if typ.IsMultiple {
+		name = "Vec<" + name + ">"
+	}
+	return template.HTML(name)
+}
+
+// rustFieldName gets the snake case Rust field name for a field.
+// Names that clash with Rust keywords are written as raw identifiers,
+// which serde still encodes using the plain name.
+// Use rust_field_name(field.Name) in templates.
+func rustFieldName(s string) string {
+	name := underscore(s)
+	for _, keyword := range rustKeywords {
+		if name == keyword {
+			return "r#" + name
+		}
+	}
+	return name
+}
+
+// rustKeywords are the Rust keywords that may not be used as field
+// names.
+var rustKeywords = []string{
+	"as", "async", "await", "break", "const", "continue", "crate", "dyn",
+	"else", "enum", "extern", "false", "fn", "for", "if", "impl", "in",
+	"let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return",
+	"static", "struct", "super", "trait", "true", "type", "unsafe", "use",
+	"where", "while", "abstract", "become", "box", "do", "final", "gen",
+	"macro", "override", "priv", "try", "typeof", "unsized", "virtual",
+	"yield",
+}
+
+// javaTypeString gets the Type as a Java string.
+// Multiple types are Lists of the boxed type.
+// Use java_type_string(type) in templates.
+func javaTypeString(typ definition.Type) template.HTML {
+	var name, boxed string
+	switch typ.Name {
+	case "string":
+		name, boxed = "String", "String"
+	case "float64":
+		name, boxed = "double", "Double"
+	case "int":
+		name, boxed = "long", "Long"
+	case "bool":
+		name, boxed = "boolean", "Boolean"
+	case "remototypes.File":
+		name, boxed = "File", "File"
+	default:
+		name, boxed = typ.Name, typ.Name
+	}
+	if typ.IsMultiple {
+		name = "List<" + boxed + ">"
+	}
+	return template.HTML(name)
+}
+
+// javaFieldName gets the camel case Java field name for a field.
+// Names that clash with Java keywords get an underscore suffix.
+// Use java_field_name(field.Name) in templates.
+func javaFieldName(s string) string {
+	name := camelizeDownFirst(s)
+	for _, keyword := range javaKeywords {
+		if name == keyword {
+			return name + "_"
+		}
+	}
+	return name
+}
+
+// javaKeywords are the Java keywords that may not be used as field
+// names.
+var javaKeywords = []string{
+	"abstract", "assert", "boolean", "break", "byte", "case", "catch",
+	"char", "class", "const", "continue", "default", "do", "double",
+	"else", "enum", "extends", "final", "finally", "float", "for", "goto",
+	"if", "implements", "import", "instanceof", "int", "interface", "long",
+	"native", "new", "package", "private", "protected", "public", "return",
+	"short", "static", "strictfp", "super", "switch", "synchronized",
+	"this", "throw", "throws", "transient", "try", "void", "volatile",
+	"while", "true", "false", "null", "var", "record", "yield",
+}
+
+// markdownAnchor gets the anchor that GitHub flavoured markdown
+// generates for a heading. For example, "Greeter.Greet" becomes
+// "greetergreet".
+// Use markdown_anchor(s) in templates.
+func markdownAnchor(s string) string {
+	var out []rune
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == ' ':
+			out = append(out, '-')
+		case r == '-', r == '_', unicode.IsLetter(r), unicode.IsDigit(r):
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+// markdownCell makes a string safe to use inside a markdown table cell,
+// joining lines and escaping pipes.
+// Use markdown_cell(s) in templates.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
 // replace is a string replacement function.
 func replace(s, old, new string) string {
 	return strings.Replace(s, old, new, -1)
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"html/template"
 	"testing"
 
 	"github.com/matryer/is"
@@ -73,6 +74,12 @@ func TestHelperUniqueStructures(t *testing.T) {
 	is.Equal(len(structs), 2)
 }
 
+func TestHelperPrefixedComment(t *testing.T) {
+	is := is.New(t)
+	is.Equal(printPrefixedComment("", "/// "), ``)
+	is.Equal(printPrefixedComment("one\ntwo", "\t/// "), "\t/// one\n\t/// two\n")
+}
+
 func TestGoTypeString(t *testing.T) {
 	is := is.New(t)
 	typ := definition.Type{
@@ -89,6 +96,11 @@ func TestGoTypeString(t *testing.T) {
 	is.Equal(goTypeString(typ), "[]string")
 }
 
+func TestGoQuote(t *testing.T) {
+	is := is.New(t)
+	is.Equal(goQuote("Rename changes a person's name.\nSecond line"), template.HTML(`"Rename changes a person's name.\nSecond line"`))
+}
+
 func TestUnderscore(t *testing.T) {
 	is := is.New(t)
 	is.Equal(underscore("hello there"), `hello_there`)
@@ -109,3 +121,49 @@ func TestReplace(t *testing.T) {
 	is := is.New(t)
 	is.Equal(replace("one two three", "two", "2"), "one 2 three")
 }
+
+func TestRustTypeString(t *testing.T) {
+	is := is.New(t)
+	is.Equal(rustTypeString(definition.Type{Name: "string"}), template.HTML("String"))
+	is.Equal(rustTypeString(definition.Type{Name: "float64"}), template.HTML("f64"))
+	is.Equal(rustTypeString(definition.Type{Name: "int"}), template.HTML("i64"))
+	is.Equal(rustTypeString(definition.Type{Name: "bool", IsMultiple: true}), template.HTML("Vec<bool>"))
+	is.Equal(rustTypeString(definition.Type{Name: "remototypes.File"}), template.HTML("File"))
+	is.Equal(rustTypeString(definition.Type{Name: "Face", IsStruct: true, IsMultiple: true}), template.HTML("Vec<Face>"))
+}
+
+func TestRustFieldName(t *testing.T) {
+	is := is.New(t)
+	is.Equal(rustFieldName("ModelID"), `model_id`)
+	is.Equal(rustFieldName("Name"), `name`)
+	is.Equal(rustFieldName("Type"), `r#type`)
+}
+
+func TestJavaTypeString(t *testing.T) {
+	is := is.New(t)
+	is.Equal(javaTypeString(definition.Type{Name: "string"}), template.HTML("String"))
+	is.Equal(javaTypeString(definition.Type{Name: "float64"}), template.HTML("double"))
+	is.Equal(javaTypeString(definition.Type{Name: "int", IsMultiple: true}), template.HTML("List<Long>"))
+	is.Equal(javaTypeString(definition.Type{Name: "bool"}), template.HTML("boolean"))
+	is.Equal(javaTypeString(definition.Type{Name: "remototypes.File"}), template.HTML("File"))
+	is.Equal(javaTypeString(definition.Type{Name: "Face", IsStruct: true, IsMultiple: true}), template.HTML("List<Face>"))
+}
+
+func TestJavaFieldName(t *testing.T) {
+	is := is.New(t)
+	is.Equal(javaFieldName("ModelID"), `modelID`)
+	is.Equal(javaFieldName("Default"), `default_`)
+}
+
+func TestMarkdownAnchor(t *testing.T) {
+	is := is.New(t)
+	is.Equal(markdownAnchor("Greeter.Greet"), `greetergreet`)
+	is.Equal(markdownAnchor("Special types"), `special-types`)
+	is.Equal(markdownAnchor("remototypes.File"), `remototypesfile`)
+}
+
+func TestMarkdownCell(t *testing.T) {
+	is := is.New(t)
+	is.Equal(markdownCell("one\ntwo"), `one two`)
+	is.Equal(markdownCell("a | b"), `a \| b`)
+}
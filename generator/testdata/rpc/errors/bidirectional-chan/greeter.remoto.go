@@ -0,0 +1,13 @@
+package testdata
+
+type Greeter interface {
+	Greet(GreetRequest) chan GreetResponse
+}
+
+type GreetRequest struct {
+	Name string
+}
+
+type GreetResponse struct {
+	Greeting string
+}
@@ -0,0 +1,25 @@
+package thumbnails
+
+import "github.com/matryer/remoto/remototypes"
+
+// Thumbnails makes thumbnails of images.
+type Thumbnails interface {
+	// Make makes thumbnails of an image.
+	Make(MakeRequest) MakeResponse
+}
+
+// MakeRequest is the request for Thumbnails.Make.
+type MakeRequest struct {
+	// Image is the image to make thumbnails of.
+	Image remototypes.File
+	// Sizes are the widths of the thumbnails to make.
+	Sizes []int
+}
+
+// MakeResponse is the response for Thumbnails.Make.
+type MakeResponse struct {
+	// Original is the original image.
+	Original remototypes.File
+	// Thumbnails are the thumbnails, one for each size.
+	Thumbnails []remototypes.File
+}
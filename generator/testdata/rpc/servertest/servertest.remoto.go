@@ -0,0 +1,49 @@
+package servertest
+
+import "github.com/matryer/remoto/remototypes"
+
+// Service is used to test the generated server.
+type Service interface {
+	// Download downloads a file.
+	Download(DownloadRequest) remototypes.FileResponse
+	// Greet greets someone.
+	Greet(GreetRequest) GreetResponse
+	// Measure gets the sizes of files.
+	Measure(MeasureRequest) MeasureResponse
+}
+
+// DownloadRequest is the request for Service.Download.
+type DownloadRequest struct {
+	// Name is the name of the file.
+	Name string
+}
+
+// GreetRequest is the request for Service.Greet.
+type GreetRequest struct {
+	Name string
+}
+
+// GreetResponse is the response for Service.Greet.
+type GreetResponse struct {
+	Greeting string
+}
+
+// MeasureRequest is the request for Service.Measure.
+type MeasureRequest struct {
+	// Inputs are the files to measure.
+	Inputs []Input
+	// Files are more files to measure, after the inputs.
+	Files []remototypes.File
+}
+
+// Input is a file to measure.
+type Input struct {
+	Name string
+	File remototypes.File
+}
+
+// MeasureResponse is the response for Service.Measure.
+type MeasureResponse struct {
+	// Sizes are the sizes of the files, in the order of the inputs.
+	Sizes []int
+}
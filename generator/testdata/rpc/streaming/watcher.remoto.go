@@ -0,0 +1,19 @@
+package watcher
+
+// Watcher provides updates as they happen.
+type Watcher interface {
+	// Watch streams changes to a document.
+	Watch(WatchRequest) <-chan WatchResponse
+}
+
+// WatchRequest is the request for Watcher.Watch.
+type WatchRequest struct {
+	// DocumentID is the ID of the document to watch.
+	DocumentID string
+}
+
+// WatchResponse is a change to the document.
+type WatchResponse struct {
+	// Change describes the change.
+	Change string
+}
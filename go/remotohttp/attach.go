@@ -0,0 +1,226 @@
+package remotohttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+	"github.com/pkg/errors"
+)
+
+// attachments are the files attached to a response (see
+// remototypes.Attach), which Encode writes after the response in a
+// multipart/mixed body.
+type attachments struct {
+	mu    sync.Mutex
+	files []attachment
+	// count is the number of files that have been attached, and is
+	// used to generate unique field names.
+	count int
+}
+
+// attachment is a file attached to a response.
+type attachment struct {
+	file remototypes.File
+	r    io.Reader
+}
+
+// attach attaches the file. It is a remototypes.Attacher.
+func (a *attachments) attach(_ context.Context, filename string, r io.Reader) (remototypes.File, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file := DescribeFile("files["+strconv.Itoa(a.count)+"]", filename, r)
+	a.count++
+	a.files = append(a.files, attachment{file: file, r: r})
+	return file, nil
+}
+
+// take removes and gets the files that have been attached.
+func (a *attachments) take() []attachment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	files := a.files
+	a.files = nil
+	return files
+}
+
+// close closes the files that have not been written.
+func (a *attachments) close() {
+	for _, file := range a.take() {
+		file.close()
+	}
+}
+
+// close closes the io.Reader of the file, if it is an io.Closer.
+func (a attachment) close() {
+	if closer, ok := a.r.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// requestAttachments gets the attachments for r, if it is being
+// handled by a Server, or nil.
+func requestAttachments(r *http.Request) *attachments {
+	if r == nil {
+		return nil
+	}
+	a, _ := r.Context().Value(contextKeyAttachments).(*attachments)
+	return a
+}
+
+// DescribeFile gets the remototypes.File for a file that will be read
+// from r. The ContentType is taken from the extension of the filename,
+// and if r is an io.ReadSeeker, the Size and SHA256 are set.
+// Generated clients use it to describe the files they upload.
+func DescribeFile(fieldname, filename string, r io.Reader) remototypes.File {
+	file := remototypes.File{
+		Fieldname:   fieldname,
+		Filename:    filename,
+		ContentType: mime.TypeByExtension(filepath.Ext(filename)),
+	}
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return file
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return file
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, rs)
+	if _, seekErr := rs.Seek(start, io.SeekStart); err == nil && seekErr == nil {
+		file.Size = n
+		file.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return file
+}
+
+// writeAttachments writes b, the encoded response, followed by the
+// files as a multipart/mixed body. The parts have a form-data
+// Content-Disposition, like multipart/form-data requests, so clients
+// can read the response with the same code.
+func writeAttachments(w http.ResponseWriter, status int, contentType string, b []byte, files []attachment) error {
+	defer func() {
+		for _, file := range files {
+			file.close()
+		}
+	}()
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(status)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="json"`)
+	h.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(b); err != nil {
+		return err
+	}
+	for _, file := range files {
+		part, err := mw.CreatePart(FileHeader(file.file))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.r); err != nil {
+			return errors.Wrapf(err, "write file %s", file.file.Fieldname)
+		}
+	}
+	return mw.Close()
+}
+
+// FileHeader gets the MIME header for the multipart part containing the
+// file, like those of multipart/form-data requests.
+// Generated clients use it to write the files they upload.
+func FileHeader(file remototypes.File) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(file.Fieldname), quoteEscaper.Replace(file.Filename)))
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	if file.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
+	return h
+}
+
+// quoteEscaper escapes quoted strings in headers, like mime/multipart.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// ResponseFiles are the files attached to a response (see
+// remototypes.Attach). Files are read from the response body as they
+// are opened, so they should be opened in the order they appear in the
+// response. Files that are skipped over are spooled to temporary files.
+type ResponseFiles struct {
+	uploads *uploads
+	body    io.Closer
+}
+
+// DecodeResponse decodes the responses from the body of resp into v,
+// with the codec. If files are attached to the responses, the
+// ResponseFiles opens them, and the body is left open until it is
+// closed. Otherwise, the ResponseFiles is nil and the body is closed.
+func DecodeResponse(resp *http.Response, codec Codec, v interface{}) (*ResponseFiles, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.EqualFold(mediaType, "multipart/mixed") {
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "read response body")
+		}
+		return nil, codec.Unmarshal(b, v)
+	}
+	files := &ResponseFiles{
+		uploads: &uploads{
+			spool: true,
+			mr:    multipart.NewReader(resp.Body, params["boundary"]),
+			files: make(map[string]*upload),
+		},
+		body: resp.Body,
+	}
+	b, err := files.uploads.readJSON()
+	if err != nil {
+		files.Close()
+		return nil, err
+	}
+	if err := codec.Unmarshal([]byte(b), v); err != nil {
+		files.Close()
+		return nil, err
+	}
+	return files, nil
+}
+
+// Open opens the file attached to the response.
+// Callers must close the file.
+func (f *ResponseFiles) Open(file remototypes.File) (io.ReadCloser, error) {
+	if f == nil {
+		return nil, errors.Errorf("missing file: %s (no files attached to response)", file.Fieldname)
+	}
+	return f.uploads.open(file)
+}
+
+// Close closes the response body, and removes any spooled files.
+// It is safe to call Close on a nil ResponseFiles.
+func (f *ResponseFiles) Close() error {
+	if f == nil {
+		return nil
+	}
+	defer f.uploads.cleanup()
+	return f.body.Close()
+}
@@ -0,0 +1,127 @@
+package remotohttp_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+)
+
+type thumbnailResponse struct {
+	Original  remototypes.File `json:"original"`
+	Thumbnail remototypes.File `json:"thumbnail"`
+}
+
+func TestAttach(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Images.Thumbnail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp thumbnailResponse
+		var err error
+		resp.Original, err = remototypes.Attach(r.Context(), "original.png", strings.NewReader("original"))
+		is.NoErr(err)
+		is.Equal(resp.Original.ContentType, "image/png")
+		is.Equal(resp.Original.Size, int64(8)) // size of an io.Seeker is known
+		// an io.Reader that isn't an io.Seeker
+		resp.Thumbnail, err = remototypes.Attach(r.Context(), "thumbnail.png", io.MultiReader(strings.NewReader("thumb")))
+		is.NoErr(err)
+		is.Equal(resp.Thumbnail.Size, int64(0))
+		is.True(resp.Original.Fieldname != resp.Thumbnail.Fieldname)
+		is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []thumbnailResponse{resp}))
+	}))
+	s := httptest.NewServer(srv)
+	defer s.Close()
+	resp, err := http.Post(s.URL+"/remoto/Images.Thumbnail", "application/json", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	is.True(strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/mixed;"))
+	var resps []thumbnailResponse
+	files, err := remotohttp.DecodeResponse(resp, remotohttp.JSON, &resps)
+	is.NoErr(err)
+	defer files.Close()
+	is.Equal(len(resps), 1)
+	is.Equal(resps[0].Thumbnail.Filename, "thumbnail.png")
+	// open out of order, so the original is spooled
+	for _, test := range []struct {
+		file     remototypes.File
+		contents string
+	}{
+		{file: resps[0].Thumbnail, contents: "thumb"},
+		{file: resps[0].Original, contents: "original"},
+	} {
+		f, err := files.Open(test.file)
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(f)
+		is.NoErr(err)
+		is.Equal(string(b), test.contents)
+		is.Equal(f.(remototypes.FileInfo).ContentType(), "image/png")
+		f.Close()
+	}
+	is.NoErr(files.Close())
+}
+
+func TestAttachNoFiles(t *testing.T) {
+	is := is.New(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Thumbnail", nil)
+	is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []thumbnailResponse{{}}))
+	var resps []thumbnailResponse
+	files, err := remotohttp.DecodeResponse(w.Result(), remotohttp.JSON, &resps)
+	is.NoErr(err)
+	is.True(files == nil)
+	is.Equal(len(resps), 1)
+	_, err = files.Open(resps[0].Original)
+	is.True(err != nil)
+	is.NoErr(files.Close()) // nil ResponseFiles can be closed
+}
+
+func TestAttachErr(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	f := &closeRecorder{Reader: strings.NewReader("original")}
+	srv.Register("/remoto/Images.Thumbnail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := remototypes.Attach(r.Context(), "original.png", f)
+		is.NoErr(err)
+		remotohttp.EncodeErr(w, r, remotohttp.Errorf(remotohttp.CodeNotFound, "no such image"))
+	}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Thumbnail", strings.NewReader(`[{}]`))
+	r.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(w, r)
+	is.Equal(w.Code, http.StatusNotFound)
+	is.True(strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+	is.True(f.closed) // attached files should be closed
+}
+
+// closeRecorder is an io.ReadCloser that records whether it has been
+// closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDescribeFile(t *testing.T) {
+	is := is.New(t)
+	file := remotohttp.DescribeFile("files[0]", `my "photo".png`, strings.NewReader("abc"))
+	is.Equal(file.Fieldname, "files[0]")
+	is.Equal(file.ContentType, "image/png")
+	is.Equal(file.Size, int64(3)) // strings.Reader is an io.ReadSeeker
+	is.Equal(file.SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+	h := remotohttp.FileHeader(file)
+	is.Equal(h.Get("Content-Disposition"), `form-data; name="files[0]"; filename="my \"photo\".png"`)
+	is.Equal(h.Get("Content-Type"), "image/png")
+	is.Equal(h.Get("Content-Length"), "3")
+	file = remotohttp.DescribeFile("files[1]", "data", ioutil.NopCloser(strings.NewReader("abc")))
+	is.Equal(file.Size, int64(0)) // not seekable, so the size is unknown
+	is.Equal(remotohttp.FileHeader(file).Get("Content-Type"), "application/octet-stream")
+}
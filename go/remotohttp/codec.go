@@ -0,0 +1,347 @@
+package remotohttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes requests and responses.
+type Codec interface {
+	// ContentType gets the Content-Type of the encoded data,
+	// e.g. application/json.
+	ContentType() string
+	// Marshal encodes v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// StreamCodec is a Codec that can decode arrays from an io.Reader one
+// element at a time, so batches of requests are decoded as they are
+// read, instead of being read into memory first. JSON, MessagePack and
+// CBOR are StreamCodecs.
+type StreamCodec interface {
+	Codec
+	// NewArrayReader makes an ArrayReader that decodes the array in r.
+	NewArrayReader(r io.Reader) ArrayReader
+}
+
+// ArrayReader decodes the elements of an array one at a time.
+type ArrayReader interface {
+	// More gets whether there is another element in the array.
+	// A null array has no elements.
+	More() (bool, error)
+	// Decode decodes the next element into v.
+	Decode(v interface{}) error
+}
+
+var (
+	// JSON is the default Codec, which encodes data as JSON.
+	JSON Codec = jsonCodec{}
+	// MessagePack is a Codec that encodes data as MessagePack.
+	// Field names are taken from json struct tags.
+	MessagePack Codec = msgpackCodec{}
+	// CBOR is a Codec that encodes data as CBOR.
+	// Field names are taken from json struct tags.
+	CBOR Codec = cborCodec{}
+)
+
+// codecs are the registered codecs, keyed by media type.
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{
+	m: map[string]Codec{
+		"application/json":      JSON,
+		"application/msgpack":   MessagePack,
+		"application/x-msgpack": MessagePack,
+		"application/cbor":      CBOR,
+	},
+}
+
+// RegisterCodec registers the codec for its Content-Type, so it is
+// used to decode requests with that Content-Type, and to encode
+// responses to requests that Accept it.
+// JSON, MessagePack and CBOR are registered by default.
+func RegisterCodec(codec Codec) {
+	mediaType, _, err := mime.ParseMediaType(codec.ContentType())
+	if err != nil {
+		panic("remotohttp: bad codec Content-Type: " + err.Error())
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[mediaType] = codec
+}
+
+// CodecFor gets the codec registered for the contentType. Parameters,
+// like charset, are ignored.
+func CodecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.m[mediaType]
+	return codec, ok
+}
+
+// Negotiate gets the Codec to encode the response with, from the
+// Accept header of the request. Media types are tried in order of
+// preference, and JSON is used if none of them are registered.
+func Negotiate(r *http.Request) Codec {
+	if r == nil {
+		return JSON
+	}
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			if q > 0 {
+				ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+			}
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	for _, mediaRange := range ranges {
+		if codec, ok := CodecFor(mediaRange.mediaType); ok {
+			return codec
+		}
+		if mediaRange.mediaType == "*/*" || mediaRange.mediaType == "application/*" {
+			return JSON
+		}
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) NewArrayReader(r io.Reader) ArrayReader {
+	return &jsonArrayReader{dec: json.NewDecoder(r)}
+}
+
+type jsonArrayReader struct {
+	dec     *json.Decoder
+	started bool
+	done    bool
+}
+
+func (r *jsonArrayReader) More() (bool, error) {
+	if r.done {
+		return false, nil
+	}
+	if !r.started {
+		r.started = true
+		tok, err := r.dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if tok == nil {
+			r.done = true
+			return false, nil
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return false, errors.New("expected array")
+		}
+	}
+	if r.dec.More() {
+		return true, nil
+	}
+	r.done = true
+	// read the closing bracket, so malformed arrays are errors
+	if _, err := r.dec.Token(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (r *jsonArrayReader) Decode(v interface{}) error {
+	return r.dec.Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (msgpackCodec) NewArrayReader(r io.Reader) ArrayReader {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return &msgpackArrayReader{dec: dec, n: -1}
+}
+
+type msgpackArrayReader struct {
+	dec     *msgpack.Decoder
+	started bool
+	n       int // elements left
+}
+
+func (r *msgpackArrayReader) More() (bool, error) {
+	if !r.started {
+		r.started = true
+		n, err := r.dec.DecodeArrayLen()
+		if err != nil {
+			return false, err
+		}
+		r.n = n
+	}
+	return r.n > 0, nil
+}
+
+func (r *msgpackArrayReader) Decode(v interface{}) error {
+	r.n--
+	return r.dec.Decode(v)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string {
+	return "application/cbor"
+}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+func (cborCodec) NewArrayReader(r io.Reader) ArrayReader {
+	return &cborArrayReader{r: bufio.NewReader(r)}
+}
+
+// cborArrayReader reads the head of the array itself, and decodes the
+// elements with a cbor.Decoder.
+type cborArrayReader struct {
+	r       *bufio.Reader
+	dec     *cbor.Decoder
+	started bool
+	n       int64 // elements left, or -1 for indefinite length arrays
+}
+
+func (r *cborArrayReader) More() (bool, error) {
+	if !r.started {
+		r.started = true
+		if err := r.readHead(); err != nil {
+			return false, err
+		}
+		r.dec = cbor.NewDecoder(r.r)
+	}
+	if r.n >= 0 {
+		return r.n > 0, nil
+	}
+	// indefinite length arrays end with a break byte, which may have
+	// been buffered by the decoder already
+	var b [1]byte
+	if _, err := r.dec.Buffered().Read(b[:]); err != nil {
+		peek, err := r.r.Peek(1)
+		if err != nil {
+			return false, err
+		}
+		b[0] = peek[0]
+	}
+	return b[0] != 0xff, nil
+}
+
+// readHead reads the head of the array, which holds its length.
+func (r *cborArrayReader) readHead() error {
+	head, err := r.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case head == 0xf6: // null
+		return nil
+	case head == 0x9f:
+		r.n = -1
+		return nil
+	case head>>5 != 4:
+		return errors.New("cbor: expected array")
+	}
+	info := head & 0x1f
+	if info < 24 {
+		r.n = int64(info)
+		return nil
+	}
+	if info > 27 {
+		return fmt.Errorf("cbor: invalid array head 0x%x", head)
+	}
+	var n uint64
+	for i := 0; i < 1<<(info-24); i++ {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		n = n<<8 | uint64(b)
+	}
+	if n > 1<<62 {
+		return errors.New("cbor: array too long")
+	}
+	r.n = int64(n)
+	return nil
+}
+
+func (r *cborArrayReader) Decode(v interface{}) error {
+	if r.n > 0 {
+		r.n--
+	}
+	return r.dec.Decode(v)
+}
@@ -0,0 +1,178 @@
+package remotohttp_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+func TestNegotiate(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		codec  remotohttp.Codec
+	}{
+		{accept: "", codec: remotohttp.JSON},
+		{accept: "application/json; charset=utf-8", codec: remotohttp.JSON},
+		{accept: "application/msgpack", codec: remotohttp.MessagePack},
+		{accept: "application/x-msgpack", codec: remotohttp.MessagePack},
+		{accept: "application/cbor", codec: remotohttp.CBOR},
+		{accept: "text/html, application/cbor", codec: remotohttp.CBOR},
+		{accept: "application/json;q=0.5, application/msgpack", codec: remotohttp.MessagePack},
+		{accept: "application/msgpack;q=0, application/cbor;q=0.1", codec: remotohttp.CBOR},
+		{accept: "*/*, application/msgpack", codec: remotohttp.JSON},
+		{accept: "text/html", codec: remotohttp.JSON},
+	} {
+		t.Run(test.accept, func(t *testing.T) {
+			is := is.New(t)
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Accept", test.accept)
+			is.Equal(remotohttp.Negotiate(r), test.codec)
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	type greetRequest struct {
+		Name string `json:"name"`
+	}
+	for _, codec := range []remotohttp.Codec{remotohttp.JSON, remotohttp.MessagePack, remotohttp.CBOR} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			is := is.New(t)
+			b, err := codec.Marshal([]greetRequest{{Name: "Mat"}})
+			is.NoErr(err)
+			r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", bytes.NewReader(b))
+			r.Header.Set("Content-Type", codec.ContentType())
+			r.Header.Set("Accept", codec.ContentType())
+			var reqs []greetRequest
+			is.NoErr(remotohttp.Decode(r, &reqs))
+			is.Equal(reqs, []greetRequest{{Name: "Mat"}})
+
+			w := httptest.NewRecorder()
+			is.NoErr(remotohttp.Encode(w, r, http.StatusOK, reqs))
+			is.Equal(w.Header().Get("Content-Type"), codec.ContentType())
+			var decoded []map[string]interface{}
+			is.NoErr(codec.Unmarshal(w.Body.Bytes(), &decoded))
+			is.Equal(decoded[0]["name"], "Mat") // json field names should be used
+
+			w = httptest.NewRecorder()
+			is.NoErr(remotohttp.EncodeErr(w, r, remotohttp.Errorf(remotohttp.CodeNotFound, "no such greeting")))
+			resp := w.Result()
+			e := remotohttp.AsError(remotohttp.ResponseErr(resp))
+			is.True(e != nil)
+			is.Equal(e.Code, remotohttp.CodeNotFound)
+			is.Equal(e.Message, "no such greeting")
+		})
+	}
+}
+
+func TestDecodeArray(t *testing.T) {
+	type greetRequest struct {
+		Name string `json:"name"`
+	}
+	marshal := func(codec remotohttp.Codec, v interface{}) []byte {
+		b, err := codec.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	// CBOR arrays of unknown length are ended with a break byte
+	indefinite := []byte{0x9f}
+	indefinite = append(indefinite, marshal(remotohttp.CBOR, greetRequest{Name: "Mat"})...)
+	indefinite = append(indefinite, marshal(remotohttp.CBOR, greetRequest{Name: "David"})...)
+	indefinite = append(indefinite, 0xff)
+	mat, david, aaron := greetRequest{Name: "Mat"}, greetRequest{Name: "David"}, greetRequest{Name: "Aaron"}
+	for _, test := range []struct {
+		name  string
+		codec remotohttp.Codec
+		body  []byte
+		want  []greetRequest
+		err   string
+	}{
+		{name: "json", codec: remotohttp.JSON, body: marshal(remotohttp.JSON, []greetRequest{mat, david}), want: []greetRequest{mat, david}},
+		{name: "json empty", codec: remotohttp.JSON, body: []byte(`[]`), want: []greetRequest{}},
+		{name: "json null", want: []greetRequest{}, codec: remotohttp.JSON, body: []byte(`null`)},
+		{name: "json object", codec: remotohttp.JSON, body: []byte(`{"name":"Mat"}`), err: "decode request: expected array"},
+		{name: "json unterminated", codec: remotohttp.JSON, body: []byte(`[{"name":"Mat"}`), err: "decode request: unexpected end of JSON input"},
+		{name: "json batch too large", codec: remotohttp.JSON, body: marshal(remotohttp.JSON, []greetRequest{mat, david, aaron}), err: "more than 2 requests in batch"},
+		{name: "json batch too large not read", codec: remotohttp.JSON, body: []byte(`[{"name":"Mat"},{"name":"David"},{"name":"Aaron"},not json`), err: "more than 2 requests in batch"},
+		{name: "msgpack", codec: remotohttp.MessagePack, body: marshal(remotohttp.MessagePack, []greetRequest{mat, david}), want: []greetRequest{mat, david}},
+		{name: "msgpack null", want: []greetRequest{}, codec: remotohttp.MessagePack, body: marshal(remotohttp.MessagePack, nil)},
+		{name: "msgpack batch too large", codec: remotohttp.MessagePack, body: marshal(remotohttp.MessagePack, []greetRequest{mat, david, aaron}), err: "more than 2 requests in batch"},
+		{name: "cbor", codec: remotohttp.CBOR, body: marshal(remotohttp.CBOR, []greetRequest{mat, david}), want: []greetRequest{mat, david}},
+		{name: "cbor indefinite length", codec: remotohttp.CBOR, body: indefinite, want: []greetRequest{mat, david}},
+		{name: "cbor null", want: []greetRequest{}, codec: remotohttp.CBOR, body: marshal(remotohttp.CBOR, nil)},
+		{name: "cbor object", codec: remotohttp.CBOR, body: marshal(remotohttp.CBOR, mat), err: "decode request: cbor: expected array"},
+		{name: "cbor batch too large", codec: remotohttp.CBOR, body: marshal(remotohttp.CBOR, []greetRequest{mat, david, aaron}), err: "more than 2 requests in batch"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			srv := &remotohttp.Server{MaxBatchSize: 2}
+			var (
+				reqs []greetRequest
+				err  error
+			)
+			srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err = remotohttp.Decode(r, &reqs)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", test.codec.ContentType())
+			srv.ServeHTTP(httptest.NewRecorder(), r)
+			if test.err != "" {
+				is.True(err != nil)
+				is.Equal(remotohttp.AsError(err).Message, test.err)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(reqs, test.want)
+		})
+	}
+}
+
+func TestStreamBatchCodec(t *testing.T) {
+	is := is.New(t)
+	type greetResponse struct {
+		Greeting string `json:"greeting"`
+	}
+	srv := &remotohttp.Server{}
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+	err := srv.StreamBatch(w, r, 2, func(ctx context.Context, i int) interface{} {
+		return greetResponse{Greeting: "Hello"}
+	})
+	is.NoErr(err)
+	is.Equal(w.Header().Get("Content-Type"), "application/msgpack")
+	var resps []greetResponse
+	is.NoErr(remotohttp.MessagePack.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(resps, []greetResponse{{Greeting: "Hello"}, {Greeting: "Hello"}})
+}
+
+func TestRegisterCodec(t *testing.T) {
+	is := is.New(t)
+	// codecs cannot be unregistered, so each run uses its own media type
+	mediaType := fmt.Sprintf("application/vnd.test%d", time.Now().UnixNano())
+	_, ok := remotohttp.CodecFor(mediaType)
+	is.Equal(ok, false)
+	remotohttp.RegisterCodec(testCodec{Codec: remotohttp.JSON, contentType: mediaType})
+	codec, ok := remotohttp.CodecFor(mediaType + "; charset=utf-8")
+	is.True(ok)
+	is.Equal(codec.ContentType(), mediaType)
+}
+
+// testCodec is a JSON codec with a different Content-Type.
+type testCodec struct {
+	remotohttp.Codec
+	contentType string
+}
+
+func (c testCodec) ContentType() string {
+	return c.contentType
+}
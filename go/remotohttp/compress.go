@@ -0,0 +1,145 @@
+package remotohttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// DefaultCompressMinBytes is the default minimum size of a response
+// that will be compressed (see Server.CompressMinBytes).
+const DefaultCompressMinBytes = 1024
+
+// compressor is a compressing io.WriteCloser.
+type compressor interface {
+	io.WriteCloser
+	// Flush writes any pending data.
+	Flush() error
+}
+
+// newCompressor makes a compressor that writes to w with the encoding,
+// which must be gzip or zstd.
+func newCompressor(w io.Writer, encoding string) (compressor, error) {
+	if encoding == "zstd" {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// acceptEncoding gets the content coding (gzip or zstd) to compress
+// the response to r with, from its Accept-Encoding header, or an empty
+// string if the response should not be compressed.
+// If both are accepted equally, gzip is preferred.
+func acceptEncoding(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	var (
+		encoding string
+		best     float64
+	)
+	for _, accept := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(accept, ",") {
+			params := strings.Split(part, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			q := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					var err error
+					if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+						q = 0
+					}
+				}
+			}
+			if name == "*" {
+				name = "gzip"
+			}
+			if (name == "gzip" || name == "zstd") && q > best {
+				encoding, best = name, q
+			}
+		}
+	}
+	return encoding
+}
+
+// compressMinBytes gets the minimum size of a response to r that
+// will be compressed. The ok value is false if compression has
+// been disabled.
+func compressMinBytes(r *http.Request) (min int, ok bool) {
+	if r != nil {
+		min, _ = r.Context().Value(contextKeyCompressMinBytes).(int)
+	}
+	if min < 0 {
+		return 0, false
+	}
+	if min == 0 {
+		min = DefaultCompressMinBytes
+	}
+	return min, true
+}
+
+// decompressBody replaces the body of r with a reader that decompresses
+// it, if it has a Content-Encoding. The decompressed body is limited to
+// the MaxBodyBytes.
+func decompressBody(r *http.Request, l limits) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var body io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return decodeErr(err)
+		}
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return decodeErr(err)
+		}
+		body = zr.IOReadCloser()
+	default:
+		return Errorf(CodeUnsupportedMediaType, "unsupported Content-Encoding %q (use gzip or zstd)", encoding)
+	}
+	if l.maxBodyBytes > 0 {
+		body = http.MaxBytesReader(nil, body, l.maxBodyBytes)
+	}
+	r.Body = body
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	return nil
+}
+
+// CompressRequest compresses the body of req with gzip, if it is at
+// least minBytes long. Servers decompress the body in Decode.
+func CompressRequest(req *http.Request, minBytes int) error {
+	if req.Body == nil || req.ContentLength < int64(minBytes) {
+		return nil
+	}
+	defer req.Body.Close()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, req.Body); err != nil {
+		return errors.Wrap(err, "compress request")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "compress request")
+	}
+	b := buf.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	req.ContentLength = int64(len(b))
+	req.Header.Set("Content-Encoding", "gzip")
+	return nil
+}
@@ -0,0 +1,189 @@
+package remotohttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeCompressed(t *testing.T) {
+	type greetRequest struct {
+		Name string `json:"name"`
+	}
+	body := []byte(`[{"name":"Mat"}]`)
+	zstdBody, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for encoding, b := range map[string][]byte{
+		"gzip": gzipBytes(t, body),
+		"zstd": zstdBody.EncodeAll(body, nil),
+	} {
+		t.Run(encoding, func(t *testing.T) {
+			is := is.New(t)
+			r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", bytes.NewReader(b))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Content-Encoding", encoding)
+			var reqs []greetRequest
+			is.NoErr(remotohttp.Decode(r, &reqs))
+			is.Equal(reqs, []greetRequest{{Name: "Mat"}})
+		})
+	}
+}
+
+func TestDecodeCompressedErrs(t *testing.T) {
+	is := is.New(t)
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[]`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "br")
+	err := remotohttp.Decode(r, &[]struct{}{})
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeUnsupportedMediaType)
+
+	r = httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[]`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	err = remotohttp.Decode(r, &[]struct{}{})
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeInvalidArgument) // not gzipped
+}
+
+func TestDecodeCompressedLimit(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{MaxBodyBytes: 100}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []map[string]string
+		if err := remotohttp.Decode(r, &reqs); err != nil {
+			srv.HandleErr(w, r, err)
+			return
+		}
+		remotohttp.Encode(w, r, http.StatusOK, reqs)
+	}))
+	// small when compressed, too large when decompressed
+	body := gzipBytes(t, []byte(`[{"name":"`+strings.Repeat("a", 1000)+`"}]`))
+	is.True(len(body) < 100)
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	is.Equal(w.Code, http.StatusRequestEntityTooLarge)
+}
+
+func TestEncodeCompressed(t *testing.T) {
+	is := is.New(t)
+	big := strings.Repeat("a", remotohttp.DefaultCompressMinBytes)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []string{big}))
+	is.Equal(w.Header().Get("Content-Encoding"), "gzip")
+	zr, err := gzip.NewReader(w.Body)
+	is.NoErr(err)
+	var resps []string
+	is.NoErr(json.NewDecoder(zr).Decode(&resps))
+	is.Equal(resps, []string{big})
+
+	// small responses are not compressed
+	w = httptest.NewRecorder()
+	is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []string{"small"}))
+	is.Equal(w.Header().Get("Content-Encoding"), "")
+	is.Equal(w.Body.String(), `["small"]`)
+
+	// zstd is used if it is preferred
+	r.Header.Set("Accept-Encoding", "gzip;q=0.5, zstd")
+	w = httptest.NewRecorder()
+	is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []string{big}))
+	is.Equal(w.Header().Get("Content-Encoding"), "zstd")
+	zstdReader, err := zstd.NewReader(w.Body)
+	is.NoErr(err)
+	defer zstdReader.Close()
+	is.NoErr(json.NewDecoder(zstdReader).Decode(&resps))
+	is.Equal(resps, []string{big})
+
+	// responses are not compressed if the client does not accept it
+	r.Header.Del("Accept-Encoding")
+	w = httptest.NewRecorder()
+	is.NoErr(remotohttp.Encode(w, r, http.StatusOK, []string{big}))
+	is.Equal(w.Header().Get("Content-Encoding"), "")
+}
+
+func TestServerCompressMinBytes(t *testing.T) {
+	is := is.New(t)
+	for _, test := range []struct {
+		min        int
+		compressed bool
+	}{
+		{min: 0, compressed: false},
+		{min: 5, compressed: true},
+		{min: -1, compressed: false},
+	} {
+		srv := &remotohttp.Server{CompressMinBytes: test.min}
+		srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remotohttp.Encode(w, r, http.StatusOK, []string{"hello"})
+		}))
+		r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		is.Equal(w.Header().Get("Content-Encoding") == "gzip", test.compressed) // CompressMinBytes
+	}
+}
+
+func TestStreamBatchCompressed(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	err := srv.StreamBatch(w, r, 3, func(ctx context.Context, i int) interface{} {
+		return map[string]int{"n": i}
+	})
+	is.NoErr(err)
+	is.Equal(w.Header().Get("Content-Encoding"), "gzip")
+	zr, err := gzip.NewReader(w.Body)
+	is.NoErr(err)
+	b, err := ioutil.ReadAll(zr)
+	is.NoErr(err)
+	is.Equal(string(b), "[{\"n\":0}\n,{\"n\":1}\n,{\"n\":2}\n]")
+}
+
+func TestCompressRequest(t *testing.T) {
+	is := is.New(t)
+	body := `[{"name":"` + strings.Repeat("a", 100) + `"}]`
+	req, err := http.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(body))
+	is.NoErr(err)
+	req.Header.Set("Content-Type", "application/json")
+	is.NoErr(remotohttp.CompressRequest(req, 10))
+	is.Equal(req.Header.Get("Content-Encoding"), "gzip")
+	is.True(req.ContentLength < int64(len(body)))
+	var reqs []map[string]string
+	is.NoErr(remotohttp.Decode(req, &reqs))
+	is.Equal(reqs[0]["name"], strings.Repeat("a", 100))
+
+	// small bodies are not compressed
+	req, err = http.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[]`))
+	is.NoErr(err)
+	is.NoErr(remotohttp.CompressRequest(req, 10))
+	is.Equal(req.Header.Get("Content-Encoding"), "")
+}
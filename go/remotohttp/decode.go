@@ -2,39 +2,143 @@ package remotohttp
 
 import (
 	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strings"
-
-	"github.com/pkg/errors"
 )
 
 // Decode extracts the incoming data from the http.Request.
+// The body is decoded with the Codec registered for its Content-Type
+// (see RegisterCodec), or from the json field of form data.
+// Batches are decoded one request at a time as they are read, if the
+// codec is a StreamCodec.
+// Bodies compressed with gzip or zstd (see Content-Encoding) are
+// decompressed.
+// Errors are an *Error with a code describing the problem, like
+// CodeInvalidArgument or CodeUnsupportedMediaType.
+// For multipart/form-data, only the parts up to the json field are
+// read; files are read when they are opened.
+// For requests handled by a Server, the MaxBatchSize limit is enforced.
 func Decode(r *http.Request, v interface{}) error {
+	l, _ := r.Context().Value(contextKeyLimits).(limits)
+	if err := decompressBody(r, l); err != nil {
+		return err
+	}
 	contentType := strings.ToLower(r.Header.Get("Content-Type"))
+	var err error
 	switch {
-	case strings.Contains(contentType, "application/json"):
-		return decodeJSON(r, v)
 	case strings.Contains(contentType, "application/x-www-form-urlencoded"),
 		strings.Contains(contentType, "multipart/form-data"):
-		return decodeFormdata(r, v)
+		err = decodeFormdata(r, v, l)
+	default:
+		codec, ok := CodecFor(contentType)
+		if !ok {
+			return Errorf(CodeUnsupportedMediaType, "unsupported Content-Type (use application/json, application/x-www-form-urlencoded, multipart/form-data or a registered codec)")
+		}
+		err = decodeBody(r, v, codec, l)
+	}
+	if err != nil {
+		return err
+	}
+	if l.maxBatchSize > 0 {
+		if val := reflect.Indirect(reflect.ValueOf(v)); val.Kind() == reflect.Slice && val.Len() > l.maxBatchSize {
+			return Errorf(CodeRequestTooLarge, "too many requests in batch: %d (limit is %d)", val.Len(), l.maxBatchSize)
+		}
 	}
-	return errors.New("unsupported Content-Type (use application/json, application/x-www-form-urlencoded or multipart/form-data)")
+	return nil
+}
+
+// limits are the limits that Decode enforces.
+type limits struct {
+	maxBodyBytes int64
+	maxBatchSize int
+	maxFileSize  int64
+	maxFiles     int
 }
 
-func decodeJSON(r *http.Request, v interface{}) error {
-	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
-		return errors.Wrap(err, "decode json")
+func decodeBody(r *http.Request, v interface{}, codec Codec, l limits) error {
+	ptr := reflect.ValueOf(v)
+	streamCodec, ok := codec.(StreamCodec)
+	if !ok || ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return decodeErr(err)
+		}
+		if err := codec.Unmarshal(b, v); err != nil {
+			return decodeErr(err)
+		}
+		return nil
+	}
+	// decode the batch one request at a time, so it is not read into
+	// memory first, and the MaxBatchSize is enforced as it is read
+	slice := ptr.Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	arr := streamCodec.NewArrayReader(r.Body)
+	for {
+		more, err := arr.More()
+		if err != nil {
+			return decodeErr(err)
+		}
+		if !more {
+			break
+		}
+		if l.maxBatchSize > 0 && slice.Len() == l.maxBatchSize {
+			// the rest of the batch is not read
+			return Errorf(CodeRequestTooLarge, "more than %d requests in batch", l.maxBatchSize)
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := arr.Decode(elem.Interface()); err != nil {
+			return decodeErr(err)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
 	}
 	return nil
 }
 
-func decodeFormdata(r *http.Request, v interface{}) error {
-	j := r.FormValue("json")
+func decodeFormdata(r *http.Request, v interface{}, l limits) error {
+	var j string
+	if strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "multipart/form-data") {
+		u := uploadsFromContext(r.Context())
+		if u == nil {
+			// not handled by a Server, so files cannot be opened
+			u = &uploads{limits: l}
+		}
+		if err := u.start(r); err != nil {
+			return err
+		}
+		var err error
+		if j, err = u.readJSON(); err != nil {
+			return err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return decodeErr(err)
+		}
+		j = r.FormValue("json")
+	}
 	if j == "" {
-		return errors.New("missing field: json")
+		return Errorf(CodeInvalidArgument, "missing field: json")
 	}
 	if err := json.Unmarshal([]byte(j), v); err != nil {
-		return errors.Wrap(err, "decode json")
+		return decodeErr(err)
 	}
 	return nil
 }
+
+// fileTooLargeErr gets the *Error for a file that is bigger than
+// the MaxFileSize.
+func fileTooLargeErr(fieldname string, max int64) error {
+	return Errorf(CodeRequestTooLarge, "file %s too large (limit is %d bytes)", fieldname, max)
+}
+
+// decodeErr gets the *Error for an error that occurred while
+// decoding the request.
+func decodeErr(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return Errorf(CodeRequestTooLarge, "request body too large (limit is %d bytes)", maxBytesErr.Limit)
+	}
+	return Errorf(CodeInvalidArgument, "decode request: %s", err)
+}
@@ -88,6 +88,34 @@ func TestDecodeMultipartForm(t *testing.T) {
 	is.Equal(requestObjects[2].Name, "Aaron")
 }
 
+func TestDecodeErrors(t *testing.T) {
+	is := is.New(t)
+	for _, test := range []struct {
+		name        string
+		contentType string
+		body        string
+		limit       int64
+		code        string
+	}{
+		{name: "bad json", contentType: "application/json", body: `[{`, code: remotohttp.CodeInvalidArgument},
+		{name: "missing json field", contentType: "application/x-www-form-urlencoded", body: `name=Mat`, code: remotohttp.CodeInvalidArgument},
+		{name: "unsupported content type", contentType: "text/plain", body: `[]`, code: remotohttp.CodeUnsupportedMediaType},
+		{name: "too large", contentType: "application/json", body: `[{"name":"Mat"}]`, limit: 4, code: remotohttp.CodeRequestTooLarge},
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/service/method", strings.NewReader(test.body))
+		is.NoErr(err)
+		req.Header.Set("Content-Type", test.contentType)
+		if test.limit > 0 {
+			req.Body = http.MaxBytesReader(nil, req.Body, test.limit)
+		}
+		var v []struct{ Name string }
+		err = remotohttp.Decode(req, &v)
+		e, ok := err.(*remotohttp.Error)
+		is.True(ok)                 // test.name
+		is.Equal(e.Code, test.code) // test.name
+	}
+}
+
 // func TestDecodeFile(t *testing.T) {
 //	is := is.New(t)
 //	type r struct {
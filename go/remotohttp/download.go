@@ -0,0 +1,175 @@
+package remotohttp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+	"github.com/pkg/errors"
+)
+
+// ServeFile writes the file in resp, returned by a method that returns a
+// remototypes.FileResponse, to w.
+//
+// If resp.Data is an io.ReadSeeker, the file is served with
+// http.ServeContent, so clients can download part of the file with a
+// Range header, and the ModTime and ETag are used for conditional
+// requests (If-Range, If-None-Match and If-Modified-Since). Calls are
+// POST requests, but the conditions are evaluated as if the file was
+// being fetched with GET, so a 304 Not Modified is sent when the file
+// has not changed. Otherwise, the whole file is copied to w. A nil Data
+// is an empty file. Data is closed once it has been written, if it is
+// an io.Closer.
+//
+// Errors before anything has been written can be sent to the client
+// instead of the file: when resp is nil, resp has an Error, or the file
+// cannot be read. Errors copying the file once the response has started
+// are returned too, but cannot be sent, and the client gets an
+// incomplete response; EncodeErr returns them rather than writing them,
+// for the caller to report. Like http.ServeContent, errors from
+// io.ReadSeeker files are not returned.
+func ServeFile(w http.ResponseWriter, r *http.Request, resp *remototypes.FileResponse) error {
+	if resp == nil {
+		return Errorf(CodeInternal, "no file in response")
+	}
+	if closer, ok := resp.Data.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if resp.Error != "" {
+		return &Error{Code: CodeUnknown, Message: resp.Error}
+	}
+	data := resp.Data
+	if data == nil {
+		data = bytes.NewReader(nil)
+	}
+	rs, seekable := data.(io.ReadSeeker)
+	if !seekable {
+		// read the start of the file before the response is started,
+		// so that if it cannot be read, the error can be sent instead
+		start := make([]byte, 512)
+		n, err := io.ReadFull(data, start)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "read file")
+		}
+		data = io.MultiReader(bytes.NewReader(start[:n]), data)
+	}
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.QuoteToASCII(resp.Filename))
+	if resp.ETag != "" {
+		w.Header().Set("ETag", resp.ETag)
+	}
+	if seekable {
+		get := r.Clone(r.Context())
+		get.Method = http.MethodGet
+		http.ServeContent(w, get, resp.Filename, resp.ModTime, rs)
+		return nil
+	}
+	if !resp.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", resp.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if resp.ContentLength > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(resp.ContentLength))
+	}
+	if _, err := io.Copy(w, data); err != nil {
+		return errors.Wrap(err, "write file")
+	}
+	return nil
+}
+
+// SetRange sets the headers of req, a request to a method that returns
+// a remototypes.FileResponse, to download the file from the offset.
+// If etag is not empty, the file is only resumed if it still has that
+// ETag; otherwise the whole file is downloaded.
+func SetRange(req *http.Request, offset int64, etag string) {
+	if offset <= 0 {
+		return
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	if etag != "" {
+		req.Header.Set("If-Range", etag)
+	}
+}
+
+// Download is a file downloaded from a method that returns a
+// remototypes.FileResponse. Callers must close it.
+type Download struct {
+	io.ReadCloser
+	Filename    string
+	ContentType string
+	// Offset is the position in the file that the download starts
+	// from. It is zero when the whole file is being downloaded, which
+	// happens if the server cannot resume the download, or the file
+	// has changed since the ETag was given to SetRange.
+	Offset int64
+	// Size is the size of the whole file in bytes, or -1 if it is not
+	// known.
+	Size int64
+	// ETag is the entity tag of the file, which can be used to resume
+	// the download later, or empty if the server didn't send one.
+	ETag    string
+	ModTime time.Time
+}
+
+// NewDownload gets the Download from resp, a successful response from
+// a method that returns a remototypes.FileResponse. The Download reads
+// from, and closes, the response body.
+func NewDownload(resp *http.Response) (*Download, error) {
+	d := &Download{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		d.Filename = params["filename"]
+	}
+	if modtime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		d.ModTime = modtime
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return d, nil
+	}
+	var err error
+	d.Offset, d.Size, err = parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parseContentRange parses a Content-Range header like
+// "bytes 100-199/200", and gets the offset and the size of the whole
+// file, or -1 if it is not known.
+func parseContentRange(header string) (offset, size int64, err error) {
+	s := strings.TrimSpace(header)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", header)
+	}
+	s = strings.TrimPrefix(s, "bytes ")
+	i := strings.Index(s, "-")
+	j := strings.Index(s, "/")
+	if i < 0 || j < i {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", header)
+	}
+	offset, err = strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", header)
+	}
+	if s[j+1:] == "*" {
+		return offset, -1, nil
+	}
+	size, err = strconv.ParseInt(s[j+1:], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", header)
+	}
+	return offset, size, nil
+}
@@ -0,0 +1,160 @@
+package remotohttp_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+)
+
+// download serves the file to a request with the headers set by
+// SetRange and the extra headers, and gets the Download.
+func download(t *testing.T, file func() *remototypes.FileResponse, offset int64, etag string, headers ...string) (*httptest.ResponseRecorder, *remotohttp.Download) {
+	is := is.New(t)
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Flip", strings.NewReader(`[{}]`))
+	remotohttp.SetRange(r, offset, etag)
+	for i := 0; i < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	is.NoErr(remotohttp.ServeFile(w, r, file()))
+	if w.Code != http.StatusOK && w.Code != http.StatusPartialContent {
+		return w, nil
+	}
+	d, err := remotohttp.NewDownload(w.Result())
+	is.NoErr(err)
+	return w, d
+}
+
+func TestServeFile(t *testing.T) {
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	file := func() *remototypes.FileResponse {
+		return &remototypes.FileResponse{
+			Filename:    "photo.png",
+			ContentType: "image/png",
+			Data:        strings.NewReader("0123456789"),
+			ModTime:     modtime,
+			ETag:        `"v1"`,
+		}
+	}
+	for _, test := range []struct {
+		name     string
+		offset   int64
+		etag     string
+		contents string
+		start    int64
+	}{
+		{name: "whole file", contents: "0123456789"},
+		{name: "resumed", offset: 4, contents: "456789", start: 4},
+		{name: "resumed with etag", offset: 4, etag: `"v1"`, contents: "456789", start: 4},
+		{name: "changed etag", offset: 4, etag: `"v0"`, contents: "0123456789"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			_, d := download(t, file, test.offset, test.etag)
+			defer d.Close()
+			b, err := ioutil.ReadAll(d)
+			is.NoErr(err)
+			is.Equal(string(b), test.contents)
+			is.Equal(d.Offset, test.start)
+			is.Equal(d.Size, int64(10))
+			is.Equal(d.Filename, "photo.png")
+			is.Equal(d.ContentType, "image/png")
+			is.Equal(d.ETag, `"v1"`)
+			is.True(d.ModTime.Equal(modtime))
+		})
+	}
+	t.Run("not modified", func(t *testing.T) {
+		is := is.New(t)
+		w, _ := download(t, file, 0, "", "If-None-Match", `"v1"`)
+		is.Equal(w.Code, http.StatusNotModified)
+	})
+	t.Run("invalid range", func(t *testing.T) {
+		is := is.New(t)
+		w, _ := download(t, file, 20, "")
+		is.Equal(w.Code, http.StatusRequestedRangeNotSatisfiable)
+	})
+}
+
+func TestServeFileNotSeeker(t *testing.T) {
+	is := is.New(t)
+	file := func() *remototypes.FileResponse {
+		return &remototypes.FileResponse{
+			Filename:      "photo.png",
+			Data:          io.MultiReader(strings.NewReader("0123456789")),
+			ContentLength: 10,
+		}
+	}
+	// the whole file is sent, since it can't be resumed
+	w, d := download(t, file, 4, "")
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("Content-Type"), "application/octet-stream")
+	defer d.Close()
+	b, err := ioutil.ReadAll(d)
+	is.NoErr(err)
+	is.Equal(string(b), "0123456789")
+	is.Equal(d.Offset, int64(0))
+	is.Equal(d.Size, int64(10))
+}
+
+func TestServeFileClosesData(t *testing.T) {
+	is := is.New(t)
+	data := &closeRecorder{Reader: strings.NewReader("data")}
+	w, d := download(t, func() *remototypes.FileResponse {
+		return &remototypes.FileResponse{Data: data}
+	}, 0, "")
+	is.Equal(w.Code, http.StatusOK)
+	d.Close()
+	is.True(data.closed)
+}
+
+func TestServeFileWriteErr(t *testing.T) {
+	is := is.New(t)
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Flip", strings.NewReader(`[{}]`))
+	w := httptest.NewRecorder()
+	// the start of the file is read before the response starts
+	data := io.MultiReader(strings.NewReader(strings.Repeat("x", 1024)), iotest.ErrReader(errors.New("disk on fire")))
+	err := remotohttp.ServeFile(w, r, &remototypes.FileResponse{Filename: "photo.png", Data: data})
+	is.True(err != nil)
+	is.Equal(err.Error(), "write file: disk on fire")
+	is.Equal(w.Code, http.StatusOK) // the response had started
+}
+
+func TestNewDownloadContentRange(t *testing.T) {
+	for _, test := range []struct {
+		contentRange string
+		offset, size int64
+		err          string
+	}{
+		{contentRange: "bytes 4-9/10", offset: 4, size: 10},
+		{contentRange: "bytes 4-9/*", offset: 4, size: -1},
+		{contentRange: "bytes */10", err: `invalid Content-Range: "bytes */10"`},
+		{contentRange: "4-9/10", err: `invalid Content-Range: "4-9/10"`},
+	} {
+		t.Run(test.contentRange, func(t *testing.T) {
+			is := is.New(t)
+			resp := &http.Response{
+				StatusCode: http.StatusPartialContent,
+				Header:     http.Header{"Content-Range": []string{test.contentRange}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}
+			d, err := remotohttp.NewDownload(resp)
+			if test.err != "" {
+				is.Equal(err.Error(), test.err)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(d.Offset, test.offset)
+			is.Equal(d.Size, test.size)
+		})
+	}
+}
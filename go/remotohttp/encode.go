@@ -1,19 +1,36 @@
 package remotohttp
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/pkg/errors"
 )
 
-// Encode writes the response.
-func Encode(w http.ResponseWriter, _ *http.Request, status int, v interface{}) error {
-	b, err := json.Marshal(v)
+// Encode writes the response, with the Codec the request Accepts
+// (see Negotiate).
+// Responses of at least Server.CompressMinBytes are compressed, if the
+// request's Accept-Encoding allows gzip or zstd.
+// If files have been attached to the response (see remototypes.Attach),
+// the response is written as multipart/mixed, with the encoded response
+// in the json part followed by the files.
+func Encode(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	codec := Negotiate(r)
+	b, err := codec.Marshal(v)
 	if err != nil {
-		return errors.Wrap(err, "encode json")
+		return errors.Wrap(err, "encode response")
+	}
+	if a := requestAttachments(r); a != nil {
+		if files := a.take(); len(files) > 0 {
+			return writeAttachments(w, status, codec.ContentType(), b, files)
+		}
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Header().Add("Vary", "Accept-Encoding")
+	if min, ok := compressMinBytes(r); ok && len(b) >= min {
+		if encoding := acceptEncoding(r); encoding != "" {
+			return writeCompressed(w, status, encoding, b)
+		}
 	}
-	w.Header().Set("Content-Type", "application/json; chatset=utf-8")
 	w.WriteHeader(status)
 	if _, err := w.Write(b); err != nil {
 		return err
@@ -21,15 +38,34 @@ func Encode(w http.ResponseWriter, _ *http.Request, status int, v interface{}) e
 	return nil
 }
 
-// EncodeErr writes an error response with http.StatusInternalServerError.
+// writeCompressed writes b compressed with the encoding.
+func writeCompressed(w http.ResponseWriter, status int, encoding string, b []byte) error {
+	cw, err := newCompressor(w, encoding)
+	if err != nil {
+		return errors.Wrap(err, "compress response")
+	}
+	w.Header().Set("Content-Encoding", encoding)
+	w.WriteHeader(status)
+	if _, err := cw.Write(b); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// EncodeErr writes an error response, with the HTTP status for the
+// code of the error (see HTTPStatus).
+// If the response to a request handled by a Server has already
+// started, e.g. the error happened while writing it, the error cannot
+// be sent, and is returned instead.
 func EncodeErr(w http.ResponseWriter, r *http.Request, err error) error {
-	// returns [{"error":"message"}]
-	e := []struct {
-		Error string `json:"error"`
-	}{
-		{
-			Error: err.Error(),
-		},
-	}
-	return Encode(w, r, http.StatusInternalServerError, e)
+	if responseStarted(r) {
+		return errors.Wrap(err, "response already started")
+	}
+	// returns [{"error":"message","error_code":"code",...}]
+	if a := requestAttachments(r); a != nil {
+		// files attached to the response are not sent with errors
+		a.close()
+	}
+	e := []ErrorResponse{NewErrorResponse(err)}
+	return Encode(w, r, HTTPStatus(e[0].ErrorCode), e)
 }
@@ -21,5 +21,26 @@ func TestEncode(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(w.Code, http.StatusOK)
 	is.Equal(w.Body.String(), `{"greeting":"Hi there"}`)
-	is.Equal(w.HeaderMap.Get("Content-Type"), "application/json; chatset=utf-8")
+	is.Equal(w.HeaderMap.Get("Content-Type"), "application/json; charset=utf-8")
+}
+
+func TestEncodeErr(t *testing.T) {
+	is := is.New(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	err := remotohttp.EncodeErr(w, r, remotohttp.Errorf(remotohttp.CodeInvalidArgument, "bad request"))
+	is.NoErr(err)
+	is.Equal(w.Code, http.StatusBadRequest)
+	is.Equal(w.Body.String(), `[{"error":"bad request","error_code":"invalid_argument","error_details":null,"error_retryable":false}]`)
+}
+
+func TestHTTPStatus(t *testing.T) {
+	is := is.New(t)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeInvalidArgument), http.StatusBadRequest)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeNotFound), http.StatusNotFound)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeMethodNotAllowed), http.StatusMethodNotAllowed)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeRequestTooLarge), http.StatusRequestEntityTooLarge)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeUnsupportedMediaType), http.StatusUnsupportedMediaType)
+	is.Equal(remotohttp.HTTPStatus(remotohttp.CodeUnknown), http.StatusInternalServerError)
+	is.Equal(remotohttp.HTTPStatus("custom_code"), http.StatusInternalServerError)
 }
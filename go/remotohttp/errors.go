@@ -0,0 +1,198 @@
+package remotohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Error codes describe the kind of error that occurred. Services may
+// also use their own codes.
+const (
+	// CodeUnknown is used for errors that do not have a code.
+	CodeUnknown = "unknown"
+	// CodeInvalidArgument indicates that the request was invalid.
+	CodeInvalidArgument = "invalid_argument"
+	// CodeNotFound indicates that something could not be found.
+	CodeNotFound = "not_found"
+	// CodeAlreadyExists indicates that something already exists.
+	CodeAlreadyExists = "already_exists"
+	// CodeAborted indicates that the request conflicted with another,
+	// like a chunk of a resumable upload written at the wrong offset.
+	CodeAborted = "aborted"
+	// CodeUnauthenticated indicates that the caller is not authenticated.
+	CodeUnauthenticated = "unauthenticated"
+	// CodePermissionDenied indicates that the caller is not allowed to
+	// make the request.
+	CodePermissionDenied = "permission_denied"
+	// CodeResourceExhausted indicates that a limit or quota has been
+	// reached.
+	CodeResourceExhausted = "resource_exhausted"
+	// CodeUnavailable indicates that the service is temporarily
+	// unavailable.
+	CodeUnavailable = "unavailable"
+	// CodeDeadlineExceeded indicates that the request took too long.
+	CodeDeadlineExceeded = "deadline_exceeded"
+	// CodeCanceled indicates that the request was cancelled, usually
+	// because the client went away.
+	CodeCanceled = "canceled"
+	// CodeUnimplemented indicates that the method is not implemented.
+	CodeUnimplemented = "unimplemented"
+	// CodeInternal indicates an internal error in the service.
+	CodeInternal = "internal"
+	// CodeMethodNotAllowed indicates that the wrong HTTP method was
+	// used, Remoto endpoints only accept POST.
+	CodeMethodNotAllowed = "method_not_allowed"
+	// CodeRequestTooLarge indicates that the request body was too large.
+	CodeRequestTooLarge = "request_too_large"
+	// CodeUnsupportedMediaType indicates that the Content-Type of the
+	// request is not supported.
+	CodeUnsupportedMediaType = "unsupported_media_type"
+)
+
+// statusClientClosedRequest is the non-standard status used when the
+// client closes the connection before the response is written.
+const statusClientClosedRequest = 499
+
+// HTTPStatus gets the HTTP status code for an error code.
+// Unknown codes are http.StatusInternalServerError.
+func HTTPStatus(code string) int {
+	switch code {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodeAlreadyExists, CodeAborted:
+		return http.StatusConflict
+	case CodeRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeUnimplemented:
+		return http.StatusNotImplemented
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CodeCanceled:
+		return statusClientClosedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a structured error. Service methods may return an *Error
+// to give callers a machine readable code and additional details, which
+// are sent in the error fields of the response.
+type Error struct {
+	// Code is a machine readable code describing the error, like
+	// CodeNotFound.
+	Code string `json:"code"`
+	// Message is a human readable description of the error.
+	Message string `json:"message"`
+	// Details are additional details about the error.
+	Details []string `json:"details,omitempty"`
+	// Retryable is whether the request may succeed if it is retried.
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// Errorf makes a new *Error with the code and a formatted message.
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+// AsError gets the *Error from err. Context errors are given
+// CodeDeadlineExceeded or CodeCanceled, other errors that are not (and
+// do not wrap) an *Error are given CodeUnknown.
+// Returns nil if err is nil.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeDeadlineExceeded, Message: err.Error(), Retryable: true}
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: CodeCanceled, Message: err.Error()}
+	}
+	return &Error{
+		Code:    CodeUnknown,
+		Message: err.Error(),
+	}
+}
+
+// ErrorResponse holds the error fields that are included in every
+// response.
+type ErrorResponse struct {
+	Error          string   `json:"error"`
+	ErrorCode      string   `json:"error_code"`
+	ErrorDetails   []string `json:"error_details"`
+	ErrorRetryable bool     `json:"error_retryable"`
+}
+
+// NewErrorResponse makes an ErrorResponse describing err.
+func NewErrorResponse(err error) ErrorResponse {
+	e := AsError(err)
+	if e == nil {
+		return ErrorResponse{}
+	}
+	return ErrorResponse{
+		Error:          e.Message,
+		ErrorCode:      e.Code,
+		ErrorDetails:   e.Details,
+		ErrorRetryable: e.Retryable,
+	}
+}
+
+// Err gets the *Error described by the response, or nil if there
+// was no error.
+func (r ErrorResponse) Err() error {
+	if r.Error == "" && r.ErrorCode == "" {
+		return nil
+	}
+	return &Error{
+		Code:      r.ErrorCode,
+		Message:   r.Error,
+		Details:   r.ErrorDetails,
+		Retryable: r.ErrorRetryable,
+	}
+}
+
+// ResponseErr gets the error from an unsuccessful http.Response. If the
+// body contains an error response in a registered codec (see
+// RegisterCodec), the *Error is returned, otherwise
+// the error describes the status. The body is not closed.
+func ResponseErr(resp *http.Response) error {
+	if codec, ok := CodecFor(resp.Header.Get("Content-Type")); ok {
+		var resps []ErrorResponse
+		if b, err := ioutil.ReadAll(resp.Body); err == nil && codec.Unmarshal(b, &resps) == nil && len(resps) > 0 {
+			if err := resps[0].Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("remote service returned %s", resp.Status)
+}
@@ -0,0 +1,58 @@
+package remotohttp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/pkg/errors"
+)
+
+func TestErrorf(t *testing.T) {
+	is := is.New(t)
+	err := remotohttp.Errorf(remotohttp.CodeNotFound, "no user %q", "mat")
+	is.Equal(err.Code, remotohttp.CodeNotFound)
+	is.Equal(err.Message, `no user "mat"`)
+	is.Equal(err.Error(), `not_found: no user "mat"`)
+}
+
+func TestAsError(t *testing.T) {
+	is := is.New(t)
+	is.True(remotohttp.AsError(nil) == nil)
+
+	e := remotohttp.AsError(errors.New("something went wrong"))
+	is.Equal(e.Code, remotohttp.CodeUnknown)
+	is.Equal(e.Message, "something went wrong")
+
+	original := remotohttp.Errorf(remotohttp.CodeUnavailable, "try later")
+	original.Retryable = true
+	e = remotohttp.AsError(errors.Wrap(original, "wrapped"))
+	is.Equal(e, original)
+}
+
+func TestErrorResponse(t *testing.T) {
+	is := is.New(t)
+	is.NoErr(remotohttp.ErrorResponse{}.Err())
+	is.NoErr(remotohttp.NewErrorResponse(nil).Err())
+
+	original := remotohttp.Errorf(remotohttp.CodeInvalidArgument, "bad name")
+	original.Details = []string{"name: too long"}
+	original.Retryable = true
+	resp := remotohttp.NewErrorResponse(original)
+	is.Equal(resp.Error, "bad name")
+	is.Equal(resp.ErrorCode, remotohttp.CodeInvalidArgument)
+	err := resp.Err()
+	e, ok := err.(*remotohttp.Error)
+	is.True(ok)
+	is.Equal(e, original)
+}
+
+func TestAsErrorContext(t *testing.T) {
+	is := is.New(t)
+	e := remotohttp.AsError(errors.Wrap(context.DeadlineExceeded, "call"))
+	is.Equal(e.Code, remotohttp.CodeDeadlineExceeded)
+	is.Equal(e.Retryable, true)
+	e = remotohttp.AsError(context.Canceled)
+	is.Equal(e.Code, remotohttp.CodeCanceled)
+}
@@ -0,0 +1,11 @@
+package servertest
+
+// The server and clients are generated from the definition in the
+// generator testdata, so the tests cover the code generated by the
+// server and client templates.
+
+//go:generate remoto generate ../../../../generator/testdata/rpc/servertest/servertest.remoto.go ../../../../templates/remotohttp/server.go.plush -o server.go
+//go:generate gofmt -w server.go
+//go:generate remoto generate ../../../../generator/testdata/rpc/servertest/servertest.remoto.go ../../../../templates/remotohttp/client.go.plush -o client/client.go
+//go:generate gofmt -w client/client.go
+//go:generate remoto generate ../../../../generator/testdata/rpc/servertest/servertest.remoto.go ../../../../templates/remotohttp/client.rs.plush -o rust/src/client.rs
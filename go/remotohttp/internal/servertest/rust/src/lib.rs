@@ -0,0 +1,29 @@
+//! Tests that the generated Rust client decodes the responses from the
+//! generated Go server, which TestRustClient writes to the directory in
+//! the REMOTO_RESPONSES environment variable.
+
+mod client;
+
+#[cfg(test)]
+mod tests {
+    use super::client::*;
+
+    /// response reads the body of the response that the Go server sent.
+    fn response(name: &str) -> String {
+        let dir = std::env::var("REMOTO_RESPONSES").expect("REMOTO_RESPONSES is not set (run TestRustClient)");
+        std::fs::read_to_string(std::path::Path::new(&dir).join(name)).expect("read response")
+    }
+
+    #[test]
+    fn greet() {
+        let responses: Vec<GreetResponse> = serde_json::from_str(&response("greet.json")).expect("decode");
+        assert_eq!(responses[0].greeting, "Hello Mat");
+        assert!(responses[0].error_details.is_empty());
+    }
+
+    #[test]
+    fn measure() {
+        let responses: Vec<MeasureResponse> = serde_json::from_str(&response("measure.json")).expect("decode");
+        assert!(responses[0].sizes.is_empty());
+    }
+}
@@ -0,0 +1,56 @@
+package servertest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp/internal/servertest"
+)
+
+// TestRustClient checks that the generated Rust client can decode the
+// responses of the generated Go server, by running the tests in the
+// rust directory with cargo. Cargo downloads the dependencies of the
+// client, so it only runs if REMOTO_TEST_RUST is set.
+func TestRustClient(t *testing.T) {
+	if os.Getenv("REMOTO_TEST_RUST") == "" {
+		t.Skip("set REMOTO_TEST_RUST=1 to test the Rust client (needs cargo)")
+	}
+	is := is.New(t)
+	greetings := map[string]func() (*servertest.GreetResponse, error){
+		"Mat": func() (*servertest.GreetResponse, error) {
+			return &servertest.GreetResponse{Greeting: "Hello Mat"}, nil
+		},
+	}
+	s := httptest.NewServer(servertest.New(service{greetings: greetings}))
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "remoto-rust")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	for _, call := range []struct {
+		path, body, file, null string
+	}{
+		{path: "/remoto/Service.Greet", body: `[{"name":"Mat"}]`, file: "greet.json", null: `"error_details":null`},
+		{path: "/remoto/Service.Measure", body: `[{}]`, file: "measure.json", null: `"sizes":null`},
+	} {
+		resp, err := http.Post(s.URL+call.path, "application/json", strings.NewReader(call.body))
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		is.NoErr(err)
+		is.Equal(resp.StatusCode, http.StatusOK)
+		is.True(strings.Contains(string(b), call.null)) // Go encodes nil slices as null
+		is.NoErr(ioutil.WriteFile(filepath.Join(dir, call.file), b, 0600))
+	}
+	cmd := exec.Command("cargo", "test", "--manifest-path", filepath.Join("rust", "Cargo.toml"))
+	cmd.Env = append(os.Environ(), "REMOTO_RESPONSES="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cargo test: %s\n%s", err, out)
+	}
+}
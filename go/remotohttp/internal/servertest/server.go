@@ -0,0 +1,317 @@
+// Code generated by Remoto; DO NOT EDIT.
+
+// Package servertest contains the HTTP server for servertest services.
+package servertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+	"github.com/pkg/errors"
+)
+
+// Service is used to test the generated server.
+type Service interface {
+
+	// Download downloads a file.
+	Download(context.Context, *DownloadRequest) (*remototypes.FileResponse, error)
+
+	// Greet greets someone.
+	Greet(context.Context, *GreetRequest) (*GreetResponse, error)
+
+	// Measure gets the sizes of files.
+	Measure(context.Context, *MeasureRequest) (*MeasureResponse, error)
+}
+
+// Run is the simplest way to run the services.
+func Run(addr string,
+	service Service,
+) error {
+	server := New(
+		service,
+	)
+	if err := server.Describe(os.Stdout); err != nil {
+		return errors.Wrap(err, "describe service")
+	}
+	if err := http.ListenAndServe(addr, server); err != nil {
+		return err
+	}
+	return nil
+}
+
+// New makes a new remotohttp.Server with the specified services
+// registered.
+func New(
+	service Service,
+) *remotohttp.Server {
+	server := &remotohttp.Server{
+		OnErr: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", r.Method, r.URL.Path, err.Error())
+			if err := remotohttp.EncodeErr(w, r, err); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: encode error: %s\n", r.Method, r.URL.Path, err.Error())
+			}
+		},
+	}
+
+	RegisterServiceServer(server, service)
+	return server
+}
+
+// RegisterServiceServer registers a Service with a remotohttp.Server.
+func RegisterServiceServer(server *remotohttp.Server, service Service) {
+	srv := &httpServiceServer{
+		service: service,
+		server:  server,
+	}
+	server.Register("/remoto/Service.Download", http.HandlerFunc(srv.handleDownload))
+	server.Register("/remoto/Service.Greet", http.HandlerFunc(srv.handleGreet))
+	server.Register("/remoto/Service.Measure", http.HandlerFunc(srv.handleMeasure))
+
+}
+
+// DownloadRequest is the request for Service.Download.
+type DownloadRequest struct {
+
+	// Name is the name of the file.
+	Name string `json:"name"`
+}
+
+// GreetRequest is the request for Service.Greet.
+type GreetRequest struct {
+	Name string `json:"name"`
+}
+
+// GreetResponse is the response for Service.Greet.
+type GreetResponse struct {
+	Greeting string `json:"greeting"`
+
+	// Error is an error message if one occurred.
+	Error string `json:"error"`
+
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string `json:"error_code"`
+
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string `json:"error_details"`
+
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool `json:"error_retryable"`
+}
+
+// Input is a file to measure.
+type Input struct {
+	Name string `json:"name"`
+
+	File remototypes.File `json:"file"`
+}
+
+// MeasureRequest is the request for Service.Measure.
+type MeasureRequest struct {
+
+	// Inputs are the files to measure.
+	Inputs []Input `json:"inputs"`
+
+	// Files are more files to measure, after the inputs.
+	Files []remototypes.File `json:"files"`
+}
+
+// MeasureResponse is the response for Service.Measure.
+type MeasureResponse struct {
+
+	// Sizes are the sizes of the files, in the order of the inputs.
+	Sizes []int `json:"sizes"`
+
+	// Error is an error message if one occurred.
+	Error string `json:"error"`
+
+	// ErrorCode is a machine readable code describing the error, if one occurred.
+	ErrorCode string `json:"error_code"`
+
+	// ErrorDetails are additional details about the error.
+	ErrorDetails []string `json:"error_details"`
+
+	// ErrorRetryable is whether the request may succeed if it is retried.
+	ErrorRetryable bool `json:"error_retryable"`
+}
+
+// httpServiceServer is an internal type that provides an
+// HTTP wrapper around Service.
+type httpServiceServer struct {
+	// service is the Service being exposed by this
+	// server.
+	service Service
+	// server is the remotohttp.Server that this server is
+	// registered with.
+	server *remotohttp.Server
+}
+
+// handleDownload is an http.Handler wrapper for Service.Download.
+func (srv *httpServiceServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	var reqs []*DownloadRequest
+	if err := remotohttp.Decode(r, &reqs); err != nil {
+		srv.server.HandleErr(w, r, err)
+		return
+	}
+
+	// single file response
+
+	if len(reqs) != 1 {
+		srv.server.HandleErr(w, r, remotohttp.Errorf(remotohttp.CodeInvalidArgument, "only single requests supported for file response endpoints"))
+		return
+	}
+
+	resp, err := srv.callDownload(r.Context(), reqs[0])
+	if err == nil {
+		// errors before the file starts to be written are sent
+		// instead of it; EncodeErr returns later ones, which are handled
+		err = remotohttp.ServeFile(w, r, resp)
+	}
+	if err != nil {
+		if err := remotohttp.EncodeErr(w, r, err); err != nil {
+			srv.server.HandleErr(w, r, err)
+		}
+		return
+	}
+
+}
+
+// callDownload calls Service.Download through the
+// interceptors of the remotohttp.Server.
+func (srv *httpServiceServer) callDownload(ctx context.Context, req *DownloadRequest) (*remototypes.FileResponse, error) {
+	info := remotohttp.CallInfo{Service: "Service", Method: "Download"}
+	resp, err := srv.server.Call(ctx, info, req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		request, ok := req.(*DownloadRequest)
+		if !ok {
+			return nil, errors.Errorf("Service.Download: expected *DownloadRequest request but got %T", req)
+		}
+		return srv.service.Download(ctx, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*remototypes.FileResponse)
+	if !ok && resp != nil {
+		return nil, errors.Errorf("Service.Download: expected *remototypes.FileResponse response but got %T", resp)
+	}
+	if response == nil {
+		return nil, remotohttp.Errorf(remotohttp.CodeInternal, "Service.Download: no response")
+	}
+	return response, nil
+}
+
+// handleGreet is an http.Handler wrapper for Service.Greet.
+func (srv *httpServiceServer) handleGreet(w http.ResponseWriter, r *http.Request) {
+	var reqs []*GreetRequest
+	if err := remotohttp.Decode(r, &reqs); err != nil {
+		srv.server.HandleErr(w, r, err)
+		return
+	}
+
+	err := srv.server.StreamBatch(w, r, len(reqs), func(ctx context.Context, i int) interface{} {
+		resp, err := srv.callGreet(ctx, reqs[i])
+		if err != nil {
+			e := remotohttp.NewErrorResponse(err)
+			return &GreetResponse{
+				Error:          e.Error,
+				ErrorCode:      e.ErrorCode,
+				ErrorDetails:   e.ErrorDetails,
+				ErrorRetryable: e.ErrorRetryable,
+			}
+		}
+		return resp
+	})
+	if err != nil {
+		srv.server.HandleErr(w, r, err)
+		return
+	}
+
+}
+
+// callGreet calls Service.Greet through the
+// interceptors of the remotohttp.Server.
+func (srv *httpServiceServer) callGreet(ctx context.Context, req *GreetRequest) (*GreetResponse, error) {
+	info := remotohttp.CallInfo{Service: "Service", Method: "Greet"}
+	resp, err := srv.server.Call(ctx, info, req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		request, ok := req.(*GreetRequest)
+		if !ok {
+			return nil, errors.Errorf("Service.Greet: expected *GreetRequest request but got %T", req)
+		}
+		return srv.service.Greet(ctx, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*GreetResponse)
+	if !ok && resp != nil {
+		return nil, errors.Errorf("Service.Greet: expected *GreetResponse response but got %T", resp)
+	}
+	if response == nil {
+		return nil, remotohttp.Errorf(remotohttp.CodeInternal, "Service.Greet: no response")
+	}
+	return response, nil
+}
+
+// handleMeasure is an http.Handler wrapper for Service.Measure.
+func (srv *httpServiceServer) handleMeasure(w http.ResponseWriter, r *http.Request) {
+	var reqs []*MeasureRequest
+	if err := remotohttp.Decode(r, &reqs); err != nil {
+		srv.server.HandleErr(w, r, err)
+		return
+	}
+
+	err := srv.server.StreamBatch(w, r, len(reqs), func(ctx context.Context, i int) interface{} {
+		resp, err := srv.callMeasure(ctx, reqs[i])
+		if err != nil {
+			e := remotohttp.NewErrorResponse(err)
+			return &MeasureResponse{
+				Error:          e.Error,
+				ErrorCode:      e.ErrorCode,
+				ErrorDetails:   e.ErrorDetails,
+				ErrorRetryable: e.ErrorRetryable,
+			}
+		}
+		return resp
+	})
+	if err != nil {
+		srv.server.HandleErr(w, r, err)
+		return
+	}
+
+}
+
+// callMeasure calls Service.Measure through the
+// interceptors of the remotohttp.Server.
+func (srv *httpServiceServer) callMeasure(ctx context.Context, req *MeasureRequest) (*MeasureResponse, error) {
+	info := remotohttp.CallInfo{Service: "Service", Method: "Measure"}
+	resp, err := srv.server.Call(ctx, info, req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		request, ok := req.(*MeasureRequest)
+		if !ok {
+			return nil, errors.Errorf("Service.Measure: expected *MeasureRequest request but got %T", req)
+		}
+		return srv.service.Measure(ctx, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*MeasureResponse)
+	if !ok && resp != nil {
+		return nil, errors.Errorf("Service.Measure: expected *MeasureResponse response but got %T", resp)
+	}
+	if response == nil {
+		return nil, remotohttp.Errorf(remotohttp.CodeInternal, "Service.Measure: no response")
+	}
+	return response, nil
+}
+
+// this is here so we don't get a compiler complaints.
+func init() {
+	var _ = remototypes.File{}
+	var _ = strconv.Itoa(0)
+	var _ = io.EOF
+}
@@ -0,0 +1,247 @@
+package servertest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/internal/servertest"
+	client "github.com/matryer/remoto/go/remotohttp/internal/servertest/client"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+)
+
+// service is a servertest.Service that returns the file or response,
+// or error, for the name in the request.
+type service struct {
+	files     map[string]func() (*remototypes.FileResponse, error)
+	greetings map[string]func() (*servertest.GreetResponse, error)
+}
+
+func (s service) Download(ctx context.Context, r *servertest.DownloadRequest) (*remototypes.FileResponse, error) {
+	return s.files[r.Name]()
+}
+
+func (s service) Greet(ctx context.Context, r *servertest.GreetRequest) (*servertest.GreetResponse, error) {
+	return s.greetings[r.Name]()
+}
+
+func (s service) Measure(ctx context.Context, r *servertest.MeasureRequest) (*servertest.MeasureResponse, error) {
+	resp := &servertest.MeasureResponse{}
+	files := make([]remototypes.File, 0, len(r.Inputs)+len(r.Files))
+	for _, input := range r.Inputs {
+		files = append(files, input.File)
+	}
+	for _, file := range append(files, r.Files...) {
+		f, err := file.Open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Sizes = append(resp.Sizes, len(b))
+	}
+	return resp, nil
+}
+
+// failingReader is an io.Reader that always fails.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk on fire")
+}
+
+// serve makes a request to the server, and gets the response.
+func serve(srv *remotohttp.Server, path, body string) *httptest.ResponseRecorder {
+	srv.OnErr = nil // don't log to stderr
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+// errorResponse decodes the error from the body of an error response.
+func errorResponse(t *testing.T, w *httptest.ResponseRecorder) remotohttp.ErrorResponse {
+	is := is.New(t)
+	is.True(strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+	is.Equal(w.Header().Get("Content-Disposition"), "") // errors are not files
+	var resps []remotohttp.ErrorResponse
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(len(resps), 1)
+	return resps[0]
+}
+
+func TestFileResponse(t *testing.T) {
+	files := map[string]func() (*remototypes.FileResponse, error){
+		"file": func() (*remototypes.FileResponse, error) {
+			return &remototypes.FileResponse{Filename: "file.txt", ContentType: "text/plain", Data: io.MultiReader(strings.NewReader("contents"))}, nil
+		},
+		"empty": func() (*remototypes.FileResponse, error) {
+			return &remototypes.FileResponse{Filename: "empty.txt"}, nil
+		},
+		"not found": func() (*remototypes.FileResponse, error) {
+			return nil, remotohttp.Errorf(remotohttp.CodeNotFound, "no such file")
+		},
+		"nil": func() (*remototypes.FileResponse, error) {
+			return nil, nil
+		},
+		"error field": func() (*remototypes.FileResponse, error) {
+			return &remototypes.FileResponse{Error: "something went wrong"}, nil
+		},
+		"unreadable": func() (*remototypes.FileResponse, error) {
+			return &remototypes.FileResponse{Filename: "file.txt", Data: failingReader{}}, nil
+		},
+	}
+	for _, test := range []struct {
+		name   string
+		status int
+		body   string
+		code   string
+	}{
+		{name: "file", status: http.StatusOK, body: "contents"},
+		{name: "empty", status: http.StatusOK, body: ""},
+		{name: "not found", status: http.StatusNotFound, code: remotohttp.CodeNotFound},
+		{name: "nil", status: http.StatusInternalServerError, code: remotohttp.CodeInternal},
+		{name: "error field", status: http.StatusInternalServerError, code: remotohttp.CodeUnknown},
+		{name: "unreadable", status: http.StatusInternalServerError, code: remotohttp.CodeUnknown},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			srv := servertest.New(service{files: files})
+			w := serve(srv, "/remoto/Service.Download", `[{"name":"`+test.name+`"}]`)
+			is.Equal(w.Code, test.status)
+			if test.code == "" {
+				is.Equal(w.Body.String(), test.body)
+				return
+			}
+			is.Equal(errorResponse(t, w).ErrorCode, test.code)
+		})
+	}
+}
+
+func TestFileResponseWriteErr(t *testing.T) {
+	is := is.New(t)
+	files := map[string]func() (*remototypes.FileResponse, error){
+		"partial": func() (*remototypes.FileResponse, error) {
+			data := io.MultiReader(strings.NewReader(strings.Repeat("x", 1024)), failingReader{})
+			return &remototypes.FileResponse{Filename: "file.txt", Data: data}, nil
+		},
+	}
+	srv := servertest.New(service{files: files})
+	var handled error
+	srv.OnErr = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+	}
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Service.Download", strings.NewReader(`[{"name":"partial"}]`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Body.String(), strings.Repeat("x", 1024)) // no error is written after the file
+	is.True(handled != nil)
+	is.True(strings.Contains(handled.Error(), "disk on fire"))
+}
+
+func TestFileResponseBatch(t *testing.T) {
+	is := is.New(t)
+	srv := servertest.New(service{})
+	w := serve(srv, "/remoto/Service.Download", `[{"name":"a"},{"name":"b"}]`)
+	is.Equal(w.Code, http.StatusBadRequest)
+	is.Equal(errorResponse(t, w).ErrorCode, remotohttp.CodeInvalidArgument)
+}
+
+func TestNilResponse(t *testing.T) {
+	is := is.New(t)
+	greetings := map[string]func() (*servertest.GreetResponse, error){
+		"nil": func() (*servertest.GreetResponse, error) {
+			return nil, nil
+		},
+		"error": func() (*servertest.GreetResponse, error) {
+			return nil, remotohttp.Errorf(remotohttp.CodeInvalidArgument, "bad name")
+		},
+		"ok": func() (*servertest.GreetResponse, error) {
+			return &servertest.GreetResponse{Greeting: "Hello"}, nil
+		},
+	}
+	srv := servertest.New(service{greetings: greetings})
+	w := serve(srv, "/remoto/Service.Greet", `[{"name":"nil"},{"name":"error"},{"name":"ok"}]`)
+	is.Equal(w.Code, http.StatusOK)
+	var resps []*servertest.GreetResponse
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(len(resps), 3)
+	for _, resp := range resps {
+		is.True(resp != nil) // every request should get a response
+	}
+	is.Equal(resps[0].ErrorCode, remotohttp.CodeInternal)
+	is.Equal(resps[0].Error, "Service.Greet: no response")
+	is.Equal(resps[1].ErrorCode, remotohttp.CodeInvalidArgument)
+	is.Equal(resps[2].Greeting, "Hello")
+	is.Equal(resps[2].ErrorCode, "")
+}
+
+func TestNilResponseFromInterceptor(t *testing.T) {
+	is := is.New(t)
+	srv := servertest.New(service{})
+	srv.Intercept(func(ctx context.Context, info remotohttp.CallInfo, req interface{}, next remotohttp.CallHandler) (interface{}, error) {
+		return nil, nil
+	})
+	w := serve(srv, "/remoto/Service.Greet", `[{"name":"ok"}]`)
+	is.Equal(w.Code, http.StatusOK)
+	var resps []*servertest.GreetResponse
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(resps[0].ErrorCode, remotohttp.CodeInternal)
+}
+
+func TestClientDownload(t *testing.T) {
+	files := map[string]func() (*remototypes.FileResponse, error){
+		"json": func() (*remototypes.FileResponse, error) {
+			return &remototypes.FileResponse{Filename: "data.json", ContentType: "application/json", Data: strings.NewReader(`{"ok":true}`)}, nil
+		},
+		"not found": func() (*remototypes.FileResponse, error) {
+			return nil, remotohttp.Errorf(remotohttp.CodeNotFound, "no such file")
+		},
+	}
+	s := httptest.NewServer(servertest.New(service{files: files}))
+	defer s.Close()
+	c := client.NewServiceClient(s.URL, http.DefaultClient)
+	t.Run("json file", func(t *testing.T) {
+		is := is.New(t)
+		f, err := c.Download(context.Background(), &client.DownloadRequest{Name: "json"})
+		is.NoErr(err) // JSON files are not errors
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		is.NoErr(err)
+		is.Equal(string(b), `{"ok":true}`)
+	})
+	t.Run("error", func(t *testing.T) {
+		is := is.New(t)
+		_, err := c.Download(context.Background(), &client.DownloadRequest{Name: "not found"})
+		is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeNotFound)
+	})
+}
+
+func TestClientNestedFiles(t *testing.T) {
+	is := is.New(t)
+	s := httptest.NewServer(servertest.New(service{}))
+	defer s.Close()
+	c := client.NewServiceClient(s.URL, http.DefaultClient)
+	req := &client.MeasureRequest{Inputs: make([]client.Input, 2)}
+	req.Inputs[0].SetFile("one.txt", strings.NewReader("1"))
+	req.Inputs[1].SetFile("three.txt", strings.NewReader("333"))
+	req.AddFiles("four.txt", strings.NewReader("4444"))
+	req.AddFiles("two.txt", strings.NewReader("22"))
+	resp, err := c.Measure(context.Background(), req)
+	is.NoErr(err)
+	is.Equal(resp.Sizes, []int{1, 3, 4, 2}) // files in nested structures and lists are uploaded
+}
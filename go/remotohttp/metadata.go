@@ -0,0 +1,289 @@
+package remotohttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MetadataHeaderPrefix is the prefix of the HTTP headers that carry
+// Metadata, e.g. the Request-Id key is sent in the X-Remoto-Request-Id
+// header.
+const MetadataHeaderPrefix = "X-Remoto-"
+
+// Metadata is information about a call that is sent alongside the
+// requests and responses, like request IDs, locales or auth tokens.
+// Keys are case insensitive, and are canonicalized like HTTP headers
+// (see http.CanonicalHeaderKey). Values must be valid in HTTP headers.
+// The Timeout key is used for deadlines (see TimeoutHeader).
+//
+// Clients send metadata with WithOutgoingMetadata, and services get it
+// with MetadataFromContext. Services send metadata back with
+// SetResponseMetadata, and clients receive it with WithResponseMetadata.
+type Metadata map[string]string
+
+// Get gets the value for the key, or an empty string if there is none.
+func (md Metadata) Get(key string) string {
+	return md[http.CanonicalHeaderKey(key)]
+}
+
+// Set sets the value for the key.
+func (md Metadata) Set(key, value string) {
+	md[http.CanonicalHeaderKey(key)] = value
+}
+
+// copy gets a copy of md, with its keys canonicalized.
+func (md Metadata) copy() Metadata {
+	c := make(Metadata, len(md))
+	for k, v := range md {
+		c.Set(k, v)
+	}
+	return c
+}
+
+// MetadataFromContext gets the metadata sent by the client with the call
+// being handled, from the X-Remoto-* headers of the request. The
+// metadata is nil if the context did not come from a request handled by
+// a Server, or if the client sent none.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(contextKeyMetadata).(Metadata)
+	if md == nil {
+		return nil
+	}
+	return md.copy()
+}
+
+// SetResponseMetadata sends md back to the client with the response to
+// the call being handled, adding to any metadata already set.
+// If it is called before the response starts to be written (i.e.
+// before the method returns), the metadata is sent in headers,
+// otherwise it is sent in trailers, which browsers cannot read.
+// Calls in the same batch share a response, and so its metadata.
+// It does nothing if the context did not come from a request handled
+// by a Server.
+func SetResponseMetadata(ctx context.Context, md Metadata) {
+	rm, ok := ctx.Value(contextKeyResponseMetadata).(*responseMetadata)
+	if !ok {
+		return
+	}
+	rm.set(md)
+}
+
+// WithOutgoingMetadata gets a context that sends md with the calls made
+// by generated clients that use it. Metadata already in ctx is kept,
+// unless md has a value for the same key.
+//
+//	ctx = remotohttp.WithOutgoingMetadata(ctx, remotohttp.Metadata{
+//		"Request-Id": requestID,
+//	})
+//	resp, err := client.Greet(ctx, req)
+func WithOutgoingMetadata(ctx context.Context, md Metadata) context.Context {
+	out := OutgoingMetadata(ctx)
+	if out == nil {
+		out = make(Metadata, len(md))
+	}
+	for k, v := range md {
+		out.Set(k, v)
+	}
+	return context.WithValue(ctx, contextKeyOutgoingMetadata, out)
+}
+
+// OutgoingMetadata gets the metadata that calls made with the context
+// will send (see WithOutgoingMetadata), or nil if there is none.
+func OutgoingMetadata(ctx context.Context) Metadata {
+	md, _ := ctx.Value(contextKeyOutgoingMetadata).(Metadata)
+	if md == nil {
+		return nil
+	}
+	return md.copy()
+}
+
+// WithResponseMetadata gets a context that receives the metadata sent
+// back with the responses to calls made by generated clients that use
+// it. The metadata from headers is added to md when the call returns;
+// metadata from trailers is added once the whole response has been
+// read, e.g. at the end of a stream.
+//
+//	md := remotohttp.Metadata{}
+//	resp, err := client.Greet(remotohttp.WithResponseMetadata(ctx, md), req)
+//	log.Println(md.Get("Request-Id"))
+//
+// The context should only be used for one call at a time.
+func WithResponseMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, contextKeyResponseMetadataReceiver, md)
+}
+
+// SetMetadataHeaders sets the X-Remoto-* headers of req to the metadata
+// from its context (see WithOutgoingMetadata).
+// Generated clients call this before each request is made.
+func SetMetadataHeaders(req *http.Request) {
+	setMetadata(req.Header, OutgoingMetadata(req.Context()))
+}
+
+// ReceiveMetadata adds the metadata from the X-Remoto-* headers of resp
+// to the Metadata given to WithResponseMetadata for the context of the
+// request, if any. The body of resp is wrapped so that metadata from
+// trailers is added when it has been read.
+// Generated clients call this for each response.
+func ReceiveMetadata(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	md, ok := resp.Request.Context().Value(contextKeyResponseMetadataReceiver).(Metadata)
+	if !ok || md == nil {
+		return
+	}
+	addMetadata(md, resp.Header)
+	resp.Body = &trailerReader{ReadCloser: resp.Body, resp: resp, md: md}
+}
+
+// trailerReader is a response body that adds the metadata from the
+// trailers of the response once it has been read.
+type trailerReader struct {
+	io.ReadCloser
+	resp *http.Response
+	md   Metadata
+	once sync.Once
+}
+
+func (r *trailerReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.once.Do(func() {
+			addMetadata(r.md, r.resp.Trailer)
+		})
+	}
+	return n, err
+}
+
+// metadataFromHeader gets the metadata from the X-Remoto-* headers in h,
+// or nil if there are none.
+func metadataFromHeader(h http.Header) Metadata {
+	return metadataWithPrefix(h, MetadataHeaderPrefix)
+}
+
+// metadataFromTrailers gets the metadata from the X-Remoto-* trailers
+// that have been set in h (see http.TrailerPrefix), or nil if there are
+// none.
+func metadataFromTrailers(h http.Header) Metadata {
+	return metadataWithPrefix(h, http.TrailerPrefix+MetadataHeaderPrefix)
+}
+
+// metadataWithPrefix gets the metadata from the headers in h that start
+// with the prefix.
+func metadataWithPrefix(h http.Header, prefix string) Metadata {
+	var md Metadata
+	for k, v := range h {
+		if !strings.HasPrefix(k, prefix) || len(k) == len(prefix) || len(v) == 0 {
+			continue
+		}
+		if md == nil {
+			md = make(Metadata)
+		}
+		md.Set(k[len(prefix):], v[0])
+	}
+	return md
+}
+
+// setMetadata sets the X-Remoto-* headers in h to the metadata.
+func setMetadata(h http.Header, md Metadata) {
+	for k, v := range md {
+		h.Set(MetadataHeaderPrefix+http.CanonicalHeaderKey(k), v)
+	}
+}
+
+// addMetadata adds the metadata from the X-Remoto-* headers in h to md.
+func addMetadata(md Metadata, h http.Header) {
+	for k, v := range metadataFromHeader(h) {
+		md[k] = v
+	}
+}
+
+// responseMetadata is the metadata to send with a response. It is sent
+// in headers until they have been written, and then in trailers.
+type responseMetadata struct {
+	mu     sync.Mutex
+	header http.Header
+	sent   bool
+}
+
+// set sets the metadata in the headers, or trailers, of the response.
+func (rm *responseMetadata) set(md Metadata) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for k, v := range md {
+		key := MetadataHeaderPrefix + http.CanonicalHeaderKey(k)
+		if rm.sent {
+			// not set with Set, which would canonicalize the prefix
+			rm.header[http.TrailerPrefix+key] = []string{v}
+			continue
+		}
+		rm.header.Set(key, v)
+	}
+}
+
+// started gets whether the headers of the response have been written.
+func (rm *responseMetadata) started() bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.sent
+}
+
+// responseStarted gets whether the response to r, a request handled
+// by a Server, has started to be written, after which errors cannot be
+// sent to the client.
+func responseStarted(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	rm, ok := r.Context().Value(contextKeyResponseMetadata).(*responseMetadata)
+	return ok && rm.started()
+}
+
+// metadataWriter is the http.ResponseWriter for calls handled by a
+// Server. It records when the headers are written, after which
+// response metadata must be sent in trailers.
+type metadataWriter struct {
+	http.ResponseWriter
+	md *responseMetadata
+}
+
+func (w *metadataWriter) WriteHeader(status int) {
+	w.md.mu.Lock()
+	defer w.md.mu.Unlock()
+	w.md.sent = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metadataWriter) Write(b []byte) (int, error) {
+	w.md.mu.Lock()
+	sent := w.md.sent
+	w.md.mu.Unlock()
+	if !sent {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying http.ResponseWriter, if it supports it.
+func (w *metadataWriter) Flush() {
+	f, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	w.md.mu.Lock()
+	sent := w.md.sent
+	w.md.mu.Unlock()
+	if !sent {
+		w.WriteHeader(http.StatusOK)
+	}
+	f.Flush()
+}
+
+// Unwrap gets the underlying http.ResponseWriter, for
+// http.ResponseController.
+func (w *metadataWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
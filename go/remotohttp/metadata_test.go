@@ -0,0 +1,113 @@
+package remotohttp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+// newMetadataServer makes a Server with a Greeter.Greet method that
+// echoes the Request-Id metadata back in headers, and a
+// Watcher.Watch streaming method that sends it back in trailers.
+func newMetadataServer(t *testing.T) *remotohttp.Server {
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := remotohttp.MetadataFromContext(r.Context())
+		remotohttp.SetResponseMetadata(r.Context(), remotohttp.Metadata{"Request-Id": md.Get("request-id")})
+		if err := remotohttp.Encode(w, r, http.StatusOK, []map[string]string{{"locale": md.Get("Locale")}}); err != nil {
+			t.Error(err)
+		}
+	}))
+	srv.Register("/remoto/Watcher.Watch", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := remotohttp.MetadataFromContext(r.Context())
+		stream := remotohttp.NewStreamWriter(w)
+		if err := stream.Send(map[string]int{"change": 1}); err != nil {
+			t.Error(err)
+		}
+		remotohttp.SetResponseMetadata(r.Context(), remotohttp.Metadata{"Request-Id": md.Get("Request-Id")})
+	}))
+	return srv
+}
+
+// callWithMetadata calls the method like a generated client, sending
+// the metadata, and gets the body and response metadata.
+func callWithMetadata(t *testing.T, client *http.Client, url string, md remotohttp.Metadata) (string, remotohttp.Metadata) {
+	is := is.New(t)
+	ctx := remotohttp.WithOutgoingMetadata(context.Background(), md)
+	received := remotohttp.Metadata{}
+	ctx = remotohttp.WithResponseMetadata(ctx, received)
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+	remotohttp.SetMetadataHeaders(req)
+	resp, err := client.Do(req)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	remotohttp.ReceiveMetadata(resp)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	b, err := ioutil.ReadAll(resp.Body)
+	is.NoErr(err)
+	return strings.TrimSpace(string(b)), received
+}
+
+func TestMetadata(t *testing.T) {
+	is := is.New(t)
+	s := httptest.NewServer(newMetadataServer(t))
+	defer s.Close()
+	body, md := callWithMetadata(t, http.DefaultClient, s.URL+"/remoto/Greeter.Greet", remotohttp.Metadata{
+		"request-id": "123",
+		"Locale":     "en-GB",
+	})
+	is.Equal(body, `[{"locale":"en-GB"}]`)
+	is.Equal(md, remotohttp.Metadata{"Request-Id": "123"})
+}
+
+func TestMetadataTrailers(t *testing.T) {
+	is := is.New(t)
+	s := httptest.NewServer(newMetadataServer(t))
+	defer s.Close()
+	body, md := callWithMetadata(t, http.DefaultClient, s.URL+"/remoto/Watcher.Watch", remotohttp.Metadata{
+		"Request-Id": "123",
+	})
+	is.Equal(body, `{"change":1}`)
+	is.Equal(md.Get("Request-Id"), "123") // set after the headers were written
+}
+
+func TestMetadataWebSocket(t *testing.T) {
+	is := is.New(t)
+	s := httptest.NewServer(http.HandlerFunc(newMetadataServer(t).ServeWebSocket))
+	defer s.Close()
+	transport, err := remotohttp.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	body, md := callWithMetadata(t, client, "http://localhost/remoto/Greeter.Greet", remotohttp.Metadata{
+		"Request-Id": "123",
+		"Locale":     "en-GB",
+	})
+	is.Equal(body, `[{"locale":"en-GB"}]`)
+	is.Equal(md.Get("Request-Id"), "123")
+	body, md = callWithMetadata(t, client, "http://localhost/remoto/Watcher.Watch", remotohttp.Metadata{
+		"Request-Id": "456",
+	})
+	is.Equal(body, `{"change":1}`)
+	is.Equal(md.Get("Request-Id"), "456")
+}
+
+func TestWithOutgoingMetadata(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	is.Equal(remotohttp.OutgoingMetadata(ctx), nil)
+	ctx = remotohttp.WithOutgoingMetadata(ctx, remotohttp.Metadata{"request-id": "123", "locale": "en-GB"})
+	ctx2 := remotohttp.WithOutgoingMetadata(ctx, remotohttp.Metadata{"Locale": "fr-FR"})
+	is.Equal(remotohttp.OutgoingMetadata(ctx), remotohttp.Metadata{"Request-Id": "123", "Locale": "en-GB"})
+	is.Equal(remotohttp.OutgoingMetadata(ctx2), remotohttp.Metadata{"Request-Id": "123", "Locale": "fr-FR"})
+	is.Equal(remotohttp.MetadataFromContext(ctx), nil) // only set for calls being handled
+}
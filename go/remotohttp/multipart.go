@@ -0,0 +1,417 @@
+package remotohttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+	"github.com/pkg/errors"
+)
+
+// uploads reads the parts of a multipart/form-data request as they are
+// needed, instead of buffering the whole body before the handler runs.
+// Decode reads up to the json field, and files are read when they are
+// opened (see remototypes.File.Open).
+//
+// Files are streamed directly from the request body when possible.
+// Files that are skipped over to get to a later part, and the rest of
+// a file that is still being read when another is opened, are spooled
+// to temporary files so they can be read later.
+type uploads struct {
+	// dir is the directory to spool files to, or empty for
+	// the default temporary directory.
+	dir string
+	// spool is whether to spool files. If false, files must be opened
+	// in order and closed before the next file is opened.
+	spool  bool
+	limits limits
+
+	mu sync.Mutex
+	mr *multipart.Reader
+	// json is the value of the json field, once it has been read.
+	json *string
+	// files are the files that have been read past, keyed by
+	// field name.
+	files map[string]*upload
+	// current is the file being read directly from the request body.
+	current *partReader
+	// count is the number of files read past so far.
+	count int
+	// temps are the paths of the spool files.
+	temps []string
+	// eof is whether all of the parts have been read.
+	eof bool
+	// err is the error that stopped the parts from being read.
+	err error
+}
+
+// upload is a file that has been read past.
+type upload struct {
+	// path is the spool file containing the file.
+	path        string
+	contentType string
+	size        int64
+	// err is why the file cannot be opened.
+	err error
+}
+
+// start starts reading the multipart body of r. It is safe to call
+// more than once.
+func (u *uploads) start(r *http.Request) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.mr != nil {
+		return nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return decodeErr(err)
+	}
+	u.mr = mr
+	u.files = make(map[string]*upload)
+	return nil
+}
+
+// readJSON reads parts until the json field, and gets its value.
+func (u *uploads) readJSON() (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for u.json == nil {
+		part, err := u.next()
+		if err != nil {
+			return "", err
+		}
+		if part == nil {
+			return "", Errorf(CodeInvalidArgument, "missing field: json")
+		}
+		if err := u.skip(part); err != nil {
+			return "", err
+		}
+	}
+	return *u.json, nil
+}
+
+// open opens the file.
+func (u *uploads) open(file remototypes.File) (io.ReadCloser, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fieldname := file.Fieldname
+	if u.mr == nil {
+		return nil, Errorf(CodeInvalidArgument, "missing file: %s", fieldname)
+	}
+	for {
+		if upload, ok := u.files[fieldname]; ok {
+			if upload.err != nil {
+				return nil, upload.err
+			}
+			f, err := os.Open(upload.path)
+			if err != nil {
+				return nil, errors.Wrap(err, "open spooled file")
+			}
+			return newOpenedFile(f, file, upload.contentType, upload.size), nil
+		}
+		part, err := u.next()
+		if err != nil {
+			return nil, err
+		}
+		if part == nil {
+			return nil, Errorf(CodeInvalidArgument, "missing file: %s", fieldname)
+		}
+		if part.FormName() == fieldname && part.FileName() != "" {
+			u.files[fieldname] = &upload{err: errors.Errorf("file %s has already been read", fieldname)}
+			u.current = &partReader{uploads: u, part: part, fieldname: fieldname}
+			size := int64(-1)
+			if file.Size > 0 {
+				size = file.Size
+			}
+			if n, err := strconv.ParseInt(part.Header.Get("Content-Length"), 10, 64); err == nil {
+				size = n
+			}
+			return newOpenedFile(u.current, file, part.Header.Get("Content-Type"), size), nil
+		}
+		if err := u.skip(part); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// next gets the next part, or nil if there are no more parts.
+// The rest of the file being read directly from the body, if any,
+// is spooled first.
+func (u *uploads) next() (*multipart.Part, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	if u.eof {
+		return nil, nil
+	}
+	if u.current != nil {
+		if err := u.current.detach(); err != nil {
+			return nil, err
+		}
+		u.current = nil
+	}
+	part, err := u.mr.NextPart()
+	if err == io.EOF {
+		u.eof = true
+		return nil, nil
+	}
+	if err != nil {
+		u.err = decodeErr(err)
+		return nil, u.err
+	}
+	if part.FileName() != "" {
+		u.count++
+		if u.limits.maxFiles > 0 && u.count > u.limits.maxFiles {
+			u.err = Errorf(CodeRequestTooLarge, "too many files: %d (limit is %d)", u.count, u.limits.maxFiles)
+			return nil, u.err
+		}
+	}
+	return part, nil
+}
+
+// skip reads past the part, keeping the json field and spooling files.
+func (u *uploads) skip(part *multipart.Part) error {
+	fieldname := part.FormName()
+	if part.FileName() == "" {
+		if fieldname != "json" || u.json != nil {
+			return nil // the rest of the part is discarded by NextPart
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			u.err = decodeErr(err)
+			return u.err
+		}
+		json := string(b)
+		u.json = &json
+		return nil
+	}
+	if _, ok := u.files[fieldname]; ok {
+		return nil
+	}
+	if !u.spool {
+		u.files[fieldname] = &upload{err: errors.Errorf("file %s was skipped (files must be opened in order)", fieldname)}
+		return nil
+	}
+	f, fileErr, err := u.spoolFile(fieldname, part, 0)
+	if err != nil {
+		return err
+	}
+	if fileErr != nil {
+		u.files[fieldname] = &upload{err: fileErr}
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "spool file")
+	}
+	u.files[fieldname] = &upload{
+		path:        f.Name(),
+		contentType: part.Header.Get("Content-Type"),
+		size:        info.Size(),
+	}
+	return nil
+}
+
+// spoolFile copies the rest of the file with the fieldname from part
+// into a new spool file, after read bytes have already been read.
+// The fileErr is why only this file cannot be read, and err is why
+// the request cannot be read any further.
+func (u *uploads) spoolFile(fieldname string, part *multipart.Part, read int64) (f *os.File, fileErr, err error) {
+	f, err = ioutil.TempFile(u.dir, "remoto-upload-")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "spool file")
+	}
+	u.temps = append(u.temps, f.Name())
+	var r io.Reader = part
+	if max := u.limits.maxFileSize; max > 0 {
+		r = io.LimitReader(r, max-read+1)
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		if _, ok := err.(*os.PathError); ok {
+			return nil, nil, errors.Wrap(err, "spool file")
+		}
+		u.err = decodeErr(err)
+		return nil, nil, u.err
+	}
+	if max := u.limits.maxFileSize; max > 0 && read+n > max {
+		f.Close()
+		return nil, fileTooLargeErr(fieldname, max), nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, errors.Wrap(err, "spool file")
+	}
+	return f, nil, nil
+}
+
+// cleanup removes the spool files.
+func (u *uploads) cleanup() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, path := range u.temps {
+		os.Remove(path)
+	}
+	u.temps = nil
+}
+
+// partReader reads a file directly from the request body, or from a
+// spool file once the part has been detached.
+type partReader struct {
+	uploads   *uploads
+	part      *multipart.Part
+	fieldname string
+	// read is the number of bytes read from the part.
+	read int64
+	// f is the spool file with the rest of the part.
+	f      *os.File
+	err    error
+	closed bool
+}
+
+// Read reads from the file.
+func (r *partReader) Read(p []byte) (int, error) {
+	r.uploads.mu.Lock()
+	defer r.uploads.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.f != nil {
+		return r.f.Read(p)
+	}
+	n, err := r.part.Read(p)
+	r.read += int64(n)
+	if max := r.uploads.limits.maxFileSize; max > 0 && r.read > max {
+		r.err = fileTooLargeErr(r.fieldname, max)
+		return 0, r.err
+	}
+	if err != nil && err != io.EOF {
+		r.err = decodeErr(err)
+		return n, r.err
+	}
+	return n, err
+}
+
+// detach spools the rest of the part, so the request body can be read
+// past it. The uploads lock must be held.
+func (r *partReader) detach() error {
+	if r.closed || r.err != nil {
+		return nil // the rest of the part is discarded by NextPart
+	}
+	if !r.uploads.spool {
+		return errors.Errorf("file %s is still open (files must be closed before the next file is opened)", r.fieldname)
+	}
+	f, fileErr, err := r.uploads.spoolFile(r.fieldname, r.part, r.read)
+	if err != nil {
+		return err
+	}
+	if fileErr != nil {
+		r.err = fileErr
+		return nil
+	}
+	r.f = f
+	return nil
+}
+
+// Close closes the file.
+func (r *partReader) Close() error {
+	r.uploads.mu.Lock()
+	defer r.uploads.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.uploads.current == r {
+		r.uploads.current = nil
+	}
+	if r.f != nil {
+		return r.f.Close()
+	}
+	return nil
+}
+
+// openedFile is an uploaded file opened by a Server. It checks the
+// file matches the Size and SHA256 given by the client as it is read.
+type openedFile struct {
+	io.ReadCloser
+	file        remototypes.File
+	contentType string
+	size        int64
+	hash        hash.Hash
+	read        int64
+}
+
+var _ remototypes.FileInfo = (*openedFile)(nil)
+
+func newOpenedFile(r io.ReadCloser, file remototypes.File, contentType string, size int64) *openedFile {
+	if contentType == "" {
+		contentType = file.ContentType
+	}
+	f := &openedFile{
+		ReadCloser:  r,
+		file:        file,
+		contentType: contentType,
+		size:        size,
+	}
+	if file.SHA256 != "" {
+		f.hash = sha256.New()
+	}
+	return f
+}
+
+// ContentType gets the Content-Type of the file.
+func (f *openedFile) ContentType() string {
+	return f.contentType
+}
+
+// Size gets the size of the file in bytes, or -1 if it is not known.
+func (f *openedFile) Size() int64 {
+	return f.size
+}
+
+// Read reads from the file.
+// Errors are an *Error with CodeInvalidArgument if the file does not
+// match its Size or SHA256.
+func (f *openedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	f.read += int64(n)
+	if f.hash != nil {
+		f.hash.Write(p[:n])
+	}
+	if f.file.Size > 0 && f.read > f.file.Size {
+		return n, Errorf(CodeInvalidArgument, "file %s is larger than its size (%d bytes)", f.file.Fieldname, f.file.Size)
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	if f.file.Size > 0 && f.read != f.file.Size {
+		return n, Errorf(CodeInvalidArgument, "file %s is %d bytes, but its size is %d bytes", f.file.Fieldname, f.read, f.file.Size)
+	}
+	if f.hash != nil && hex.EncodeToString(f.hash.Sum(nil)) != strings.ToLower(f.file.SHA256) {
+		return n, Errorf(CodeInvalidArgument, "file %s does not match its sha256 checksum", f.file.Fieldname)
+	}
+	return n, err
+}
+
+// uploadsFromContext gets the uploads for the request being handled
+// by a Server, or nil.
+func uploadsFromContext(ctx context.Context) *uploads {
+	u, _ := ctx.Value(contextKeyUploads).(*uploads)
+	return u
+}
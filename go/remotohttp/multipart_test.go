@@ -0,0 +1,258 @@
+package remotohttp_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+)
+
+// serveUpload serves a request with the json and files (as files[0],
+// files[1], etc.) to the handler, registered with srv.
+func serveUpload(t *testing.T, srv *remotohttp.Server, handler http.HandlerFunc, json string, files ...string) *httptest.ResponseRecorder {
+	is := is.New(t)
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	is.NoErr(w.WriteField("json", json))
+	for i, contents := range files {
+		f, err := w.CreateFormFile(fmt.Sprintf("files[%d]", i), "file.txt")
+		is.NoErr(err)
+		io.WriteString(f, contents)
+	}
+	is.NoErr(w.Close())
+	srv.Register("/remoto/Images.Upload", handler)
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Upload", &buf)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, r)
+	return rec
+}
+
+// readFile opens and reads the file with the fieldname.
+func readFile(r *http.Request, fieldname string) (string, error) {
+	f, err := remototypes.File{Fieldname: fieldname}.Open(r.Context())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	return string(b), err
+}
+
+func TestUploadsInOrder(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	srv := &remotohttp.Server{SpoolDir: dir}
+	rec := serveUpload(t, srv, func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct{}
+		is.NoErr(remotohttp.Decode(r, &reqs))
+		contents, err := readFile(r, "files[0]")
+		is.NoErr(err)
+		is.Equal(contents, "first")
+		contents, err = readFile(r, "files[1]")
+		is.NoErr(err)
+		is.Equal(contents, "second")
+		spooled, err := ioutil.ReadDir(dir)
+		is.NoErr(err)
+		is.Equal(len(spooled), 0) // files opened in order should not be spooled
+		_, err = readFile(r, "files[0]")
+		is.True(err != nil) // files read from the body can only be opened once
+		_, err = readFile(r, "files[2]")
+		is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeInvalidArgument)
+		w.WriteHeader(http.StatusOK)
+	}, `[{}]`, "first", "second")
+	is.Equal(rec.Code, http.StatusOK)
+}
+
+func TestUploadsSpooled(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	srv := &remotohttp.Server{SpoolDir: dir}
+	rec := serveUpload(t, srv, func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct{}
+		is.NoErr(remotohttp.Decode(r, &reqs))
+		// open a file before the first one is finished with
+		first, err := remototypes.File{Fieldname: "files[0]"}.Open(r.Context())
+		is.NoErr(err)
+		defer first.Close()
+		b := make([]byte, 2)
+		_, err = io.ReadFull(first, b)
+		is.NoErr(err)
+		contents, err := readFile(r, "files[2]")
+		is.NoErr(err)
+		is.Equal(contents, "third")
+		rest, err := ioutil.ReadAll(first)
+		is.NoErr(err)
+		is.Equal(string(b)+string(rest), "first")
+		// skipped files can be opened, more than once
+		for i := 0; i < 2; i++ {
+			contents, err = readFile(r, "files[1]")
+			is.NoErr(err)
+			is.Equal(contents, "second")
+		}
+		spooled, err := ioutil.ReadDir(dir)
+		is.NoErr(err)
+		is.Equal(len(spooled), 2)
+		w.WriteHeader(http.StatusOK)
+	}, `[{}]`, "first", "second", "third")
+	is.Equal(rec.Code, http.StatusOK)
+	spooled, err := ioutil.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(spooled), 0) // spool files should be removed
+}
+
+func TestUploadsNoSpool(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{NoSpool: true}
+	rec := serveUpload(t, srv, func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct{}
+		is.NoErr(remotohttp.Decode(r, &reqs))
+		first, err := remototypes.File{Fieldname: "files[0]"}.Open(r.Context())
+		is.NoErr(err)
+		_, err = readFile(r, "files[1]")
+		is.True(err != nil) // files[0] is still open
+		first.Close()
+		contents, err := readFile(r, "files[2]")
+		is.NoErr(err)
+		is.Equal(contents, "third")
+		_, err = readFile(r, "files[1]")
+		is.True(err != nil) // files[1] was skipped
+		w.WriteHeader(http.StatusOK)
+	}, `[{}]`, "first", "second", "third")
+	is.Equal(rec.Code, http.StatusOK)
+}
+
+func TestUploadsStreamed(t *testing.T) {
+	is := is.New(t)
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	decoded := make(chan struct{})
+	go func() {
+		w.WriteField("json", `[{}]`)
+		f, _ := w.CreateFormFile("files[0]", "file.txt")
+		// the handler should be called before the file is uploaded
+		select {
+		case <-decoded:
+		case <-time.After(10 * time.Second):
+		}
+		io.WriteString(f, "contents")
+		pw.CloseWithError(w.Close())
+	}()
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Images.Upload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct{}
+		is.NoErr(remotohttp.Decode(r, &reqs))
+		close(decoded)
+		contents, err := readFile(r, "files[0]")
+		is.NoErr(err)
+		is.Equal(contents, "contents")
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Upload", pr)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ServeHTTP(rec, r)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out: upload was buffered before the handler was called")
+	}
+	is.Equal(rec.Code, http.StatusOK)
+}
+
+func TestUploadsFileInfo(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	is.NoErr(w.WriteField("json", `[{}]`))
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="files[0]"; filename="photo.png"`)
+	h.Set("Content-Type", "image/png")
+	h.Set("Content-Length", "4")
+	f, err := w.CreatePart(h)
+	is.NoErr(err)
+	io.WriteString(f, "data")
+	f, err = w.CreateFormFile("files[1]", "file.txt")
+	is.NoErr(err)
+	io.WriteString(f, "second")
+	is.NoErr(w.Close())
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Images.Upload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct{}
+		is.NoErr(remotohttp.Decode(r, &reqs))
+		second, err := remototypes.File{Fieldname: "files[1]"}.Open(r.Context())
+		is.NoErr(err)
+		defer second.Close()
+		info := second.(remototypes.FileInfo)
+		is.Equal(info.ContentType(), "application/octet-stream")
+		is.Equal(info.Size(), int64(-1)) // streamed without a Content-Length
+		first, err := remototypes.File{Fieldname: "files[0]"}.Open(r.Context())
+		is.NoErr(err)
+		defer first.Close()
+		info = first.(remototypes.FileInfo)
+		is.Equal(info.ContentType(), "image/png")
+		is.Equal(info.Size(), int64(4)) // spooled
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Images.Upload", &buf)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, r)
+	is.Equal(rec.Code, http.StatusOK)
+}
+
+func TestUploadsChecked(t *testing.T) {
+	sum := sha256.Sum256([]byte("contents"))
+	for _, test := range []struct {
+		name string
+		file remototypes.File
+		err  string
+	}{
+		{name: "size and checksum", file: remototypes.File{Size: 8, SHA256: hex.EncodeToString(sum[:])}},
+		{name: "upper case checksum", file: remototypes.File{SHA256: strings.ToUpper(hex.EncodeToString(sum[:]))}},
+		{name: "bad checksum", file: remototypes.File{SHA256: hex.EncodeToString(sum[1:])}, err: "file files[0] does not match its sha256 checksum"},
+		{name: "too small", file: remototypes.File{Size: 9}, err: "file files[0] is 8 bytes, but its size is 9 bytes"},
+		{name: "too large", file: remototypes.File{Size: 7}, err: "file files[0] is larger than its size (7 bytes)"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			srv := &remotohttp.Server{}
+			rec := serveUpload(t, srv, func(w http.ResponseWriter, r *http.Request) {
+				var reqs []struct{}
+				is.NoErr(remotohttp.Decode(r, &reqs))
+				file := test.file
+				file.Fieldname = "files[0]"
+				f, err := file.Open(r.Context())
+				is.NoErr(err)
+				defer f.Close()
+				_, err = ioutil.ReadAll(f)
+				if test.err == "" {
+					is.NoErr(err)
+					return
+				}
+				e := remotohttp.AsError(err)
+				is.True(e != nil)
+				is.Equal(e.Code, remotohttp.CodeInvalidArgument)
+				is.Equal(e.Message, test.err)
+			}, `[{}]`, "contents")
+			is.Equal(rec.Code, http.StatusOK)
+		})
+	}
+}
@@ -4,14 +4,29 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 // File describes a binary file.
-// This type is only allowed in requests, for responses RPC methods should
-// return a FileResponse.
+// Files in requests are uploaded by the client, either with the request
+// or beforehand with a resumable upload, and opened with Open.
+// Files in responses are attached by the service with Attach. Methods
+// that only return a single file may return a FileResponse instead.
+// ContentType, Size and SHA256 are set by the client, and are optional.
+// When a Size or SHA256 is given, servers check the file matches it as
+// it is read.
 type File struct {
-	Fieldname string `json:"fieldname"`
-	Filename  string `json:"filename"`
+	Fieldname   string `json:"fieldname"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the file.
+	SHA256 string `json:"sha256,omitempty"`
+	// UploadID is the ID of the resumable upload that the file was
+	// uploaded with, if it was uploaded before the request rather
+	// than with it.
+	UploadID string `json:"uploadId,omitempty"`
 }
 
 // Open opens the file as an io.ReadCloser.
@@ -24,13 +39,45 @@ func (f File) Open(ctx context.Context) (io.ReadCloser, error) {
 	return opener(ctx, f)
 }
 
+// Attach attaches the contents of a file to the response, and gets the
+// File to return in the response that refers to it. The file is read
+// from r when the response is written, and r is closed if it is an
+// io.Closer.
+func Attach(ctx context.Context, filename string, r io.Reader) (File, error) {
+	attacher, ok := ctx.Value(contextKeyFileAttacher).(Attacher)
+	if !ok {
+		return File{}, errors.New("attacher missing from context")
+	}
+	return attacher(ctx, filename, r)
+}
+
+// FileInfo describes a file as it was uploaded, from the header of its
+// part of the multipart/form-data request. The io.ReadCloser returned
+// by Open implements FileInfo for files uploaded to a server.
+type FileInfo interface {
+	// ContentType gets the Content-Type of the file.
+	ContentType() string
+	// Size gets the size of the file in bytes, or -1 if it is not
+	// known.
+	Size() int64
+}
+
 // FileResponse is response type for a file.
+// If Data is an io.ReadSeeker (like an *os.File or a *bytes.Reader),
+// clients can download part of the file, or resume a download, and
+// ModTime and ETag are used to tell whether the file has changed.
 type FileResponse struct {
 	Filename      string    `json:"filename"`
 	ContentType   string    `json:"contentType"`
 	ContentLength int       `json:"contentLength"`
 	Data          io.Reader `json:"-"`
 	Error         string    `json:"error"`
+	// ModTime is when the file was last modified, or zero if it is not
+	// known.
+	ModTime time.Time `json:"-"`
+	// ETag is the entity tag of the file, including the quotes
+	// (for example "v1"), or empty if there isn't one.
+	ETag string `json:"-"`
 }
 
 // Opener is a function that knows how to open files.
@@ -41,6 +88,14 @@ func WithOpener(ctx context.Context, opener Opener) context.Context {
 	return context.WithValue(ctx, contextKeyFileOpener, opener)
 }
 
+// Attacher is a function that knows how to attach files to responses.
+type Attacher func(ctx context.Context, filename string, r io.Reader) (File, error)
+
+// WithAttacher gets a new context.Context with the specified Attacher.
+func WithAttacher(ctx context.Context, attacher Attacher) context.Context {
+	return context.WithValue(ctx, contextKeyFileAttacher, attacher)
+}
+
 // contextKey is a local context key type.
 // see https://medium.com/@matryer/context-keys-in-go-5312346a868d
 type contextKey string
@@ -52,3 +107,7 @@ func (c contextKey) String() string {
 // contextKeyFileOpener is the context key for a function capable of
 // opening files.
 var contextKeyFileOpener = contextKey("files")
+
+// contextKeyFileAttacher is the context key for a function capable of
+// attaching files to responses.
+var contextKeyFileAttacher = contextKey("attacher")
@@ -0,0 +1,385 @@
+package remotohttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+	"github.com/pkg/errors"
+)
+
+// UploadsPath is the path that ServeUploads must be registered at.
+//
+//	mux.HandleFunc(remotohttp.UploadsPath, server.ServeUploads)
+const UploadsPath = "/remoto/uploads/"
+
+// DefaultChunkSize is the size of the chunks an Uploader uploads,
+// if its ChunkSize is zero.
+const DefaultChunkSize = 8 << 20
+
+// ServeUploads serves resumable uploads, which are kept in the
+// UploadStore. Large files can be uploaded in chunks, and uploads that
+// are interrupted carry on from where they left off, instead of being
+// sent again in full. See Uploader for a client.
+//
+// The protocol is:
+//
+//	POST   /remoto/uploads/              create an upload (the body is an UploadInfo)
+//	GET    /remoto/uploads/{id}          get the UploadInfo, to find the Offset to resume from
+//	PUT    /remoto/uploads/{id}          write a chunk at the offset in the Upload-Offset header
+//	POST   /remoto/uploads/{id}/complete complete the upload, and get its remototypes.File
+//	DELETE /remoto/uploads/{id}          delete the upload
+//
+// The remototypes.File refers to the completed upload with its
+// UploadID. Requests that include it can open it with File.Open, like
+// a file uploaded with the request.
+//
+// Middleware added with Use is called for requests to ServeUploads
+// too, and can get the metadata sent by the Uploader with
+// MetadataFromContext. MaxBodyBytes limits the size of each chunk, and MaxFileSize the
+// size of each file.
+func (srv *Server) ServeUploads(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(context.WithValue(r.Context(), contextKeyMetadata, metadataFromHeader(r.Header)))
+	srv.chain("", "", http.HandlerFunc(srv.serveUploads)).ServeHTTP(w, r)
+}
+
+func (srv *Server) serveUploads(w http.ResponseWriter, r *http.Request) {
+	if srv.UploadStore == nil {
+		srv.HandleErr(w, r, Errorf(CodeNotFound, "resumable uploads are not supported"))
+		return
+	}
+	if srv.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, srv.MaxBodyBytes)
+	}
+	path := strings.TrimPrefix(r.URL.Path, UploadsPath)
+	id := strings.TrimSuffix(path, "/complete")
+	var err error
+	switch {
+	case path == "" && r.Method == http.MethodPost:
+		err = srv.createUpload(w, r)
+	case path == "":
+		err = uploadMethodErr(w, r, http.MethodPost)
+	case strings.Contains(id, "/"):
+		err = Errorf(CodeNotFound, "unknown endpoint: %s", r.URL.Path)
+	case id != path && r.Method == http.MethodPost:
+		err = srv.completeUpload(w, r, id)
+	case id != path:
+		err = uploadMethodErr(w, r, http.MethodPost)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		var info UploadInfo
+		info, err = srv.UploadStore.Get(r.Context(), id)
+		if err == nil {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+			err = Encode(w, r, http.StatusOK, info)
+		}
+	case r.Method == http.MethodPut:
+		err = srv.writeUpload(w, r, id)
+	case r.Method == http.MethodDelete:
+		err = srv.UploadStore.Delete(r.Context(), id)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		err = uploadMethodErr(w, r, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+	}
+	if err != nil {
+		srv.HandleErr(w, r, err)
+	}
+}
+
+// createUpload creates an upload described by the UploadInfo in the
+// body of r.
+func (srv *Server) createUpload(w http.ResponseWriter, r *http.Request) error {
+	var info UploadInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return decodeErr(err)
+	}
+	if info.Size < 0 {
+		return Errorf(CodeInvalidArgument, "invalid size: %d", info.Size)
+	}
+	if max := srv.MaxFileSize; max > 0 && info.Size > max {
+		return fileTooLargeErr(info.Filename, max)
+	}
+	if info.ContentType == "" {
+		info.ContentType = mime.TypeByExtension(filepath.Ext(info.Filename))
+	}
+	info, err := srv.UploadStore.Create(r.Context(), info)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", UploadsPath+info.ID)
+	return Encode(w, r, http.StatusCreated, info)
+}
+
+// writeUpload writes the body of r to the upload, at the offset in the
+// Upload-Offset header.
+func (srv *Server) writeUpload(w http.ResponseWriter, r *http.Request, id string) error {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return Errorf(CodeInvalidArgument, "invalid Upload-Offset header: %q", r.Header.Get("Upload-Offset"))
+	}
+	info, err := srv.UploadStore.Get(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	// limit is the most the upload can be
+	limit := info.Size
+	if max := srv.MaxFileSize; max > 0 && (limit == 0 || max < limit) {
+		limit = max
+	}
+	body := &bodyReader{r: r.Body}
+	if limit > 0 {
+		body.r = io.LimitReader(r.Body, limit-offset)
+	}
+	written, err := srv.UploadStore.Write(r.Context(), id, offset, body)
+	if written.ID != "" {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(written.Offset, 10))
+	}
+	if body.err != nil && body.err != io.EOF {
+		return decodeErr(body.err)
+	}
+	if err != nil {
+		return err
+	}
+	if limit > 0 && written.Offset >= limit {
+		// anything left in the body is too much
+		if n, _ := r.Body.Read(make([]byte, 1)); n > 0 {
+			if info.Size > 0 {
+				return Errorf(CodeInvalidArgument, "upload %s is larger than its size (%d bytes)", id, info.Size)
+			}
+			return fileTooLargeErr(info.Filename, limit)
+		}
+	}
+	return Encode(w, r, http.StatusOK, written)
+}
+
+// completeUpload completes the upload, after checking it matches its
+// Size and SHA256, and writes the remototypes.File that refers to it.
+func (srv *Server) completeUpload(w http.ResponseWriter, r *http.Request, id string) error {
+	ctx := r.Context()
+	info, err := srv.UploadStore.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if info.Size > 0 && info.Offset != info.Size {
+		return Errorf(CodeInvalidArgument, "upload %s is %d bytes, but its size is %d bytes", id, info.Offset, info.Size)
+	}
+	if info.SHA256 != "" {
+		f, err := srv.UploadStore.Open(ctx, id)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "read upload")
+		}
+		if hex.EncodeToString(h.Sum(nil)) != strings.ToLower(info.SHA256) {
+			return Errorf(CodeInvalidArgument, "upload %s does not match its sha256 checksum", id)
+		}
+	}
+	info, err = srv.UploadStore.Complete(ctx, id)
+	if err != nil {
+		return err
+	}
+	return Encode(w, r, http.StatusOK, remototypes.File{
+		Filename:    info.Filename,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		SHA256:      info.SHA256,
+		UploadID:    info.ID,
+	})
+}
+
+// openUpload opens a file that refers to a completed upload.
+func (srv *Server) openUpload(ctx context.Context, file remototypes.File) (io.ReadCloser, error) {
+	if srv.UploadStore == nil {
+		return nil, Errorf(CodeInvalidArgument, "file %s: resumable uploads are not supported", file.UploadID)
+	}
+	info, err := srv.UploadStore.Get(ctx, file.UploadID)
+	if err != nil {
+		if e := AsError(err); e.Code == CodeNotFound {
+			return nil, Errorf(CodeInvalidArgument, "missing file: %s", e.Message)
+		}
+		return nil, err
+	}
+	if !info.Complete {
+		return nil, Errorf(CodeInvalidArgument, "upload %s is not complete", file.UploadID)
+	}
+	f, err := srv.UploadStore.Open(ctx, file.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	return newOpenedFile(f, file, info.ContentType, info.Size), nil
+}
+
+// bodyReader reads a request body, and records the error from reading
+// it, so it can be told apart from errors writing it.
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// uploadMethodErr sets the Allow header, and gets the error for a
+// request to ServeUploads with the wrong method.
+func uploadMethodErr(w http.ResponseWriter, r *http.Request, allow ...string) error {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	return Errorf(CodeMethodNotAllowed, "method %s not allowed (use %s)", r.Method, strings.Join(allow, ", "))
+}
+
+// Uploader uploads files to a Server in chunks, with the resumable
+// upload protocol (see Server.ServeUploads). Use the remototypes.File
+// it gets in requests instead of uploading the file with the request:
+//
+//	uploader := &remotohttp.Uploader{Endpoint: "http://localhost:8080"}
+//	file, err := uploader.Upload(ctx, "video.mp4", f)
+//	if err != nil {
+//		return err
+//	}
+//	request.SetVideoUpload(file)
+//
+// Metadata in the context (see WithOutgoingMetadata) is sent with each
+// request.
+type Uploader struct {
+	// Endpoint is the URL of the server. Files are uploaded to
+	// Endpoint+UploadsPath.
+	Endpoint string
+	// Client is the http.Client to make requests with. By default,
+	// http.DefaultClient is used.
+	Client *http.Client
+	// ChunkSize is the size of each chunk in bytes. Zero means
+	// DefaultChunkSize.
+	ChunkSize int64
+}
+
+// Upload uploads the file read from r. If it fails part way through,
+// Upload doesn't start again; to resume uploads that are interrupted,
+// use Create and Resume instead.
+func (u *Uploader) Upload(ctx context.Context, filename string, r io.ReadSeeker) (remototypes.File, error) {
+	info, err := u.Create(ctx, filename, r)
+	if err != nil {
+		return remototypes.File{}, err
+	}
+	return u.Resume(ctx, info.ID, r)
+}
+
+// Create creates an upload for the file, which Resume uploads from r.
+// The ContentType is taken from the extension of the filename, and
+// the Size and SHA256 are taken from r so the server can check the
+// file.
+func (u *Uploader) Create(ctx context.Context, filename string, r io.ReadSeeker) (UploadInfo, error) {
+	file := DescribeFile("", filename, r)
+	b, err := json.Marshal(UploadInfo{
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		SHA256:      file.SHA256,
+	})
+	if err != nil {
+		return UploadInfo{}, errors.Wrap(err, "Uploader.Create")
+	}
+	var info UploadInfo
+	if err := u.do(ctx, http.MethodPost, "", nil, bytes.NewReader(b), &info); err != nil {
+		return UploadInfo{}, errors.Wrap(err, "Uploader.Create")
+	}
+	return info, nil
+}
+
+// Resume uploads the file from r to the upload with the id, starting
+// from where the server got up to, and completes the upload.
+// The positions of the chunks in r are the offsets of the upload, so
+// r should be the same as the one given to Create, like an *os.File
+// opened again. If Resume fails, it can be called again to carry on.
+func (u *Uploader) Resume(ctx context.Context, id string, r io.ReadSeeker) (remototypes.File, error) {
+	var info UploadInfo
+	if err := u.do(ctx, http.MethodGet, id, nil, nil, &info); err != nil {
+		return remototypes.File{}, errors.Wrap(err, "Uploader.Resume")
+	}
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	for !info.Complete && (info.Size == 0 || info.Offset < info.Size) {
+		if _, err := r.Seek(info.Offset, io.SeekStart); err != nil {
+			return remototypes.File{}, errors.Wrap(err, "Uploader.Resume: seek")
+		}
+		offset := info.Offset
+		header := http.Header{"Upload-Offset": []string{strconv.FormatInt(offset, 10)}}
+		if err := u.do(ctx, http.MethodPut, id, header, io.LimitReader(r, chunkSize), &info); err != nil {
+			return remototypes.File{}, errors.Wrap(err, "Uploader.Resume")
+		}
+		if info.Offset == offset {
+			break // the end of the file
+		}
+	}
+	var file remototypes.File
+	if err := u.do(ctx, http.MethodPost, id+"/complete", nil, nil, &file); err != nil {
+		return remototypes.File{}, errors.Wrap(err, "Uploader.Resume")
+	}
+	return file, nil
+}
+
+// Delete deletes the upload, to abandon it.
+func (u *Uploader) Delete(ctx context.Context, id string) error {
+	if err := u.do(ctx, http.MethodDelete, id, nil, nil, nil); err != nil {
+		return errors.Wrap(err, "Uploader.Delete")
+	}
+	return nil
+}
+
+// do makes a request to the path, relative to the uploads endpoint,
+// and decodes the response into v.
+func (u *Uploader) do(ctx context.Context, method, path string, header http.Header, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(u.Endpoint, "/")+UploadsPath+path, body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if method == http.MethodPost && body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("Accept", "application/json; charset=utf-8")
+	req = req.WithContext(ctx)
+	SetMetadataHeaders(req)
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return ResponseErr(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response body")
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,179 @@
+package remotohttp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
+)
+
+// newUploadServer makes a test server for resumable uploads, with an
+// endpoint that reads the file in the request.
+func newUploadServer(t *testing.T, srv *remotohttp.Server) *httptest.Server {
+	srv.Register("/remoto/Images.Upload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			Image remototypes.File `json:"image"`
+		}
+		if err := remotohttp.Decode(r, &reqs); err != nil {
+			remotohttp.EncodeErr(w, r, err)
+			return
+		}
+		f, err := reqs[0].Image.Open(r.Context())
+		if err != nil {
+			remotohttp.EncodeErr(w, r, err)
+			return
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			remotohttp.EncodeErr(w, r, err)
+			return
+		}
+		w.Write(b)
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/remoto/", srv)
+	mux.HandleFunc(remotohttp.UploadsPath, srv.ServeUploads)
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// callUpload calls the upload endpoint with the file, and gets its
+// contents as read by the server.
+func callUpload(t *testing.T, s *httptest.Server, file remototypes.File) (int, string) {
+	is := is.New(t)
+	b, err := remotohttp.JSON.Marshal([]interface{}{map[string]interface{}{"image": file}})
+	is.NoErr(err)
+	resp, err := http.Post(s.URL+"/remoto/Images.Upload", "application/json", strings.NewReader(string(b)))
+	is.NoErr(err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	is.NoErr(err)
+	return resp.StatusCode, string(body)
+}
+
+func TestUploader(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{UploadStore: &remotohttp.DiskUploadStore{Dir: t.TempDir()}}
+	s := newUploadServer(t, srv)
+	uploader := &remotohttp.Uploader{Endpoint: s.URL, ChunkSize: 3}
+	file, err := uploader.Upload(context.Background(), "photo.png", strings.NewReader("chunked contents"))
+	is.NoErr(err)
+	is.True(file.UploadID != "")
+	is.Equal(file.Filename, "photo.png")
+	is.Equal(file.ContentType, "image/png")
+	is.Equal(file.Size, int64(16))
+	is.True(file.SHA256 != "")
+	status, body := callUpload(t, s, file)
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "chunked contents")
+}
+
+func TestUploaderResume(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	srv := &remotohttp.Server{UploadStore: &remotohttp.DiskUploadStore{Dir: t.TempDir()}}
+	s := newUploadServer(t, srv)
+	uploader := &remotohttp.Uploader{Endpoint: s.URL}
+	r := strings.NewReader("contents")
+	info, err := uploader.Create(ctx, "file.txt", r)
+	is.NoErr(err)
+	is.Equal(info.Size, int64(8))
+	// the upload is interrupted after some of the file is sent
+	_, err = srv.UploadStore.Write(ctx, info.ID, 0, strings.NewReader("cont"))
+	is.NoErr(err)
+	file, err := uploader.Resume(ctx, info.ID, strings.NewReader("XXXXents"))
+	is.NoErr(err) // only the rest of the file is sent
+	status, body := callUpload(t, s, file)
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "contents")
+	is.NoErr(uploader.Delete(ctx, info.ID))
+	status, _ = callUpload(t, s, file)
+	is.Equal(status, http.StatusBadRequest) // the upload has been deleted
+}
+
+func TestServeUploadsErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name     string
+		maxFile  int64
+		size     int64
+		sha256   string
+		contents string
+		code     string
+	}{
+		{name: "too small", size: 10, contents: "contents", code: remotohttp.CodeInvalidArgument},
+		{name: "too large", size: 4, contents: "contents", code: remotohttp.CodeInvalidArgument},
+		{name: "bad checksum", sha256: strings.Repeat("0", 64), contents: "contents", code: remotohttp.CodeInvalidArgument},
+		{name: "over the limit", maxFile: 4, contents: "contents", code: remotohttp.CodeRequestTooLarge},
+		{name: "declared over the limit", maxFile: 4, size: 8, contents: "contents", code: remotohttp.CodeRequestTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			srv := &remotohttp.Server{
+				UploadStore: &remotohttp.DiskUploadStore{Dir: t.TempDir()},
+				MaxFileSize: test.maxFile,
+			}
+			s := newUploadServer(t, srv)
+			uploader := &remotohttp.Uploader{Endpoint: s.URL}
+			// bypass Create, which describes the file correctly
+			info := remotohttp.UploadInfo{Filename: "file.txt", Size: test.size, SHA256: test.sha256}
+			b, err := remotohttp.JSON.Marshal(info)
+			is.NoErr(err)
+			resp, err := http.Post(s.URL+remotohttp.UploadsPath, "application/json", strings.NewReader(string(b)))
+			is.NoErr(err)
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				is.Equal(remotohttp.AsError(remotohttp.ResponseErr(resp)).Code, test.code)
+				return
+			}
+			is.NoErr(remotohttp.JSON.Unmarshal(readAll(t, resp), &info))
+			_, err = uploader.Resume(ctx, info.ID, strings.NewReader(test.contents))
+			is.Equal(remotohttp.AsError(err).Code, test.code)
+		})
+	}
+}
+
+func TestServeUploadsOffset(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{UploadStore: &remotohttp.DiskUploadStore{Dir: t.TempDir()}}
+	s := newUploadServer(t, srv)
+	info, err := srv.UploadStore.Create(context.Background(), remotohttp.UploadInfo{Filename: "file.txt"})
+	is.NoErr(err)
+	req, err := http.NewRequest(http.MethodPut, s.URL+remotohttp.UploadsPath+info.ID, strings.NewReader("contents"))
+	is.NoErr(err)
+	req.Header.Set("Upload-Offset", "4")
+	resp, err := http.DefaultClient.Do(req)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusConflict)
+	is.Equal(remotohttp.AsError(remotohttp.ResponseErr(resp)).Code, remotohttp.CodeAborted)
+	// an incomplete upload cannot be used
+	status, _ := callUpload(t, s, remototypes.File{UploadID: info.ID})
+	is.Equal(status, http.StatusBadRequest)
+}
+
+func TestServeUploadsNotSupported(t *testing.T) {
+	is := is.New(t)
+	s := newUploadServer(t, &remotohttp.Server{})
+	resp, err := http.Post(s.URL+remotohttp.UploadsPath, "application/json", strings.NewReader(`{}`))
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusNotFound)
+	status, _ := callUpload(t, s, remototypes.File{UploadID: strings.Repeat("0", 32)})
+	is.Equal(status, http.StatusBadRequest)
+}
+
+// readAll reads the body of the response.
+func readAll(t *testing.T, resp *http.Response) []byte {
+	b, err := ioutil.ReadAll(resp.Body)
+	is.New(t).NoErr(err)
+	return b
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/matryer/remoto/go/remotohttp/remototypes"
@@ -13,16 +14,93 @@ import (
 type Server struct {
 	handlers sync.Map
 
-	// NotFound handles 404 responses.
+	// mu protects middleware, methodMiddleware, interceptors and
+	// methodTimeouts.
+	mu               sync.RWMutex
+	middleware       []Middleware
+	methodMiddleware map[string][]Middleware
+	interceptors     []Interceptor
+	methodTimeouts   map[string]Timeout
+
+	// NotFound handles requests to unknown endpoints. By default,
+	// a JSON error response is written with http.StatusNotFound.
 	NotFound http.Handler
 
 	// OnErr is called when there has been a system level error,
-	// like encoding/decoding.
+	// like encoding/decoding. By default, the error is written
+	// with EncodeErr.
 	OnErr func(w http.ResponseWriter, r *http.Request, err error)
 
 	// NewClient gets a new http.Client. By default,
 	// returns http.DefaultClient.
 	NewClient func() *http.Client
+
+	// Concurrency is the maximum number of requests in a batch that
+	// will be handled at the same time. By default (zero), requests
+	// in a batch are handled one after the other.
+	// It also limits the calls in progress on each WebSocket
+	// connection (see ServeWebSocket).
+	Concurrency int
+
+	// MaxBodyBytes is the maximum size of a request body, including
+	// any files. Zero means no limit.
+	MaxBodyBytes int64
+	// MaxBatchSize is the maximum number of requests in a batch.
+	// Zero means no limit.
+	MaxBatchSize int
+	// MaxFileSize is the maximum size of each uploaded file.
+	// Zero means no limit.
+	MaxFileSize int64
+	// MaxFiles is the maximum number of files that may be uploaded
+	// with a request. Zero means no limit.
+	MaxFiles int
+
+	// SpoolDir is the directory that uploaded files are spooled to.
+	// Files are read directly from the request body when they are
+	// opened in order, and spooled when they are skipped over or
+	// another file is opened before they have been closed.
+	// Empty means the default directory for temporary files.
+	SpoolDir string
+	// NoSpool disables spooling of uploaded files, so files must be
+	// opened in the order they were uploaded, and closed before the
+	// next file is opened.
+	NoSpool bool
+
+	// CompressMinBytes is the minimum size of a response that will be
+	// compressed, for clients that accept gzip or zstd. Zero means
+	// DefaultCompressMinBytes, and a negative value disables
+	// compression.
+	CompressMinBytes int
+
+	// Timeout limits how long calls may take, for methods that do
+	// not have their own (see TimeoutMethod). Clients send their
+	// own timeout, up to the Max, in the TimeoutHeader.
+	Timeout Timeout
+
+	// UploadStore stores resumable uploads (see ServeUploads). If nil,
+	// resumable uploads are not supported.
+	UploadStore UploadStore
+
+	// CheckOrigin is called by ServeWebSocket to check the Origin
+	// header of the request. By default, cross-origin requests
+	// are refused.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// HandleErr handles a system level error by calling OnErr, or writing
+// the error with EncodeErr if OnErr is nil. Errors that happen once the
+// response has started to be written cannot be sent to the client, so
+// they are only passed to OnErr.
+func (srv *Server) HandleErr(w http.ResponseWriter, r *http.Request, err error) {
+	if srv.OnErr != nil {
+		srv.OnErr(w, r, err)
+		return
+	}
+	if responseStarted(r) {
+		return
+	}
+	// nothing more can be done if this fails
+	_ = EncodeErr(w, r, err)
 }
 
 // Register registers the path with the http.Handler.
@@ -30,31 +108,289 @@ func (srv *Server) Register(path string, fn http.Handler) {
 	srv.handlers.Store(path, fn)
 }
 
-// ServeHTTP calls the registered handler
+// Middleware wraps an http.Handler with additional behaviour, like
+// authentication, logging or metrics.
+// Use MethodFromContext to find out which method is being called.
+type Middleware func(http.Handler) http.Handler
+
+// Use adds middleware that is called for every request to a registered
+// endpoint. Middleware is called in the order it is added, before any
+// middleware added with UseMethod.
+func (srv *Server) Use(middleware ...Middleware) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.middleware = append(srv.middleware, middleware...)
+}
+
+// UseMethod adds middleware that is only called for requests to the
+// specified method, e.g. UseMethod("Greeter", "Greet", authMiddleware).
+func (srv *Server) UseMethod(service, method string, middleware ...Middleware) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.methodMiddleware == nil {
+		srv.methodMiddleware = make(map[string][]Middleware)
+	}
+	key := service + "." + method
+	srv.methodMiddleware[key] = append(srv.methodMiddleware[key], middleware...)
+}
+
+// chain wraps the handler in the middleware for the method.
+func (srv *Server) chain(service, method string, handler http.Handler) http.Handler {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	middleware := srv.methodMiddleware[service+"."+method]
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	for i := len(srv.middleware) - 1; i >= 0; i-- {
+		handler = srv.middleware[i](handler)
+	}
+	return handler
+}
+
+// CallInfo describes a call to a service method.
+type CallInfo struct {
+	// Service is the name of the service, e.g. Greeter.
+	Service string
+	// Method is the name of the method, e.g. Greet.
+	Method string
+}
+
+// CallHandler handles a single call, taking a typed request
+// (e.g. *GreetRequest) and returning a typed response
+// (e.g. *GreetResponse).
+type CallHandler func(ctx context.Context, request interface{}) (interface{}, error)
+
+// Interceptor is called around each individual call to a service
+// method, including each item in a batch request. Interceptors may
+// inspect or modify the request and response, or return an error
+// instead of calling next.
+type Interceptor func(ctx context.Context, info CallInfo, request interface{}, next CallHandler) (interface{}, error)
+
+// Intercept adds interceptors that are called around every call.
+// Interceptors are called in the order they are added.
+func (srv *Server) Intercept(interceptors ...Interceptor) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.interceptors = append(srv.interceptors, interceptors...)
+}
+
+// Call calls the handler through the interceptors. Generated servers
+// use Call for each call to a service method.
+func (srv *Server) Call(ctx context.Context, info CallInfo, request interface{}, handler CallHandler) (interface{}, error) {
+	srv.mu.RLock()
+	interceptors := srv.interceptors
+	srv.mu.RUnlock()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, request interface{}) (interface{}, error) {
+			return interceptor(ctx, info, request, next)
+		}
+	}
+	return handler(ctx, request)
+}
+
+// ServeHTTP calls the registered handler.
+// Requests to unknown endpoints get a 404 (see NotFound), and requests
+// that are not POST get a 405. The context of the request is cancelled
+// when its timeout is up (see Timeout).
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	h, ok := srv.handlers.Load(r.URL.Path)
+	if !ok {
 		if srv.NotFound != nil {
 			srv.NotFound.ServeHTTP(w, r)
 			return
 		}
-		http.NotFound(w, r)
+		srv.HandleErr(w, r, Errorf(CodeNotFound, "unknown endpoint: %s", r.URL.Path))
 		return
 	}
-	h, ok := srv.handlers.Load(r.URL.Path)
-	if !ok {
-		srv.NotFound.ServeHTTP(w, r)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		srv.HandleErr(w, r, Errorf(CodeMethodNotAllowed, "method %s not allowed (use POST)", r.Method))
 		return
 	}
 	handler, ok := h.(http.Handler)
 	if !ok {
 		panic("remotohttp: handler is the wrong type")
 	}
-	opener := func(_ context.Context, file remototypes.File) (io.ReadCloser, error) {
-		f, _, err := r.FormFile(file.Fieldname)
-		return f, err
+	service, method := parsePath(r.URL.Path)
+	timeout, err := srv.timeout(service, method, r)
+	if err != nil {
+		srv.HandleErr(w, r, err)
+		return
+	}
+	if srv.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, srv.MaxBodyBytes)
+	}
+	l := limits{
+		maxBodyBytes: srv.MaxBodyBytes,
+		maxBatchSize: srv.MaxBatchSize,
+		maxFileSize:  srv.MaxFileSize,
+		maxFiles:     srv.MaxFiles,
+	}
+	u := &uploads{dir: srv.SpoolDir, spool: !srv.NoSpool, limits: l}
+	defer u.cleanup()
+	opener := func(ctx context.Context, file remototypes.File) (io.ReadCloser, error) {
+		if file.UploadID != "" {
+			return srv.openUpload(ctx, file)
+		}
+		return u.open(file)
+	}
+	a := &attachments{}
+	defer a.close()
+	attacher := a.attach
+	if _, ok := w.(*wsResponseWriter); ok {
+		attacher = func(context.Context, string, io.Reader) (remototypes.File, error) {
+			return remototypes.File{}, Errorf(CodeUnimplemented, "files cannot be attached to responses sent over WebSockets")
+		}
+	}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx = remototypes.WithOpener(ctx, opener)
+	ctx = remototypes.WithAttacher(ctx, attacher)
+	ctx = context.WithValue(ctx, contextKeyUploads, u)
+	ctx = context.WithValue(ctx, contextKeyAttachments, a)
+	ctx = context.WithValue(ctx, contextKeyLimits, l)
+	ctx = context.WithValue(ctx, contextKeyCompressMinBytes, srv.CompressMinBytes)
+	ctx = context.WithValue(ctx, contextKeyService, service)
+	ctx = context.WithValue(ctx, contextKeyMethod, method)
+	rm := &responseMetadata{header: w.Header()}
+	ctx = context.WithValue(ctx, contextKeyMetadata, metadataFromHeader(r.Header))
+	ctx = context.WithValue(ctx, contextKeyResponseMetadata, rm)
+	r = r.WithContext(ctx)
+	srv.chain(service, method, handler).ServeHTTP(&metadataWriter{ResponseWriter: w, md: rm}, r)
+}
+
+// MethodFromContext gets the service and method names of the call
+// being handled, e.g. "Greeter" and "Greet" for requests to
+// /remoto/Greeter.Greet.
+// The ok value is false if the context did not come from a request
+// handled by a Server.
+func MethodFromContext(ctx context.Context) (service, method string, ok bool) {
+	service, ok = ctx.Value(contextKeyService).(string)
+	if !ok {
+		return "", "", false
+	}
+	method, ok = ctx.Value(contextKeyMethod).(string)
+	return service, method, ok
+}
+
+// parsePath gets the service and method names from a path like
+// /remoto/Service.Method.
+func parsePath(path string) (service, method string) {
+	name := path[strings.LastIndex(path, "/")+1:]
+	dot := strings.Index(name, ".")
+	if dot == -1 {
+		return name, ""
+	}
+	return name[:dot], name[dot+1:]
+}
+
+// contextKey is a local context key type.
+// see https://medium.com/@matryer/context-keys-in-go-5312346a868d
+type contextKey string
+
+func (c contextKey) String() string {
+	return "remotohttp context key: " + string(c)
+}
+
+var (
+	// contextKeyLimits is the context key for the limits that
+	// Decode enforces.
+	contextKeyLimits = contextKey("limits")
+	// contextKeyUploads is the context key for the uploads that
+	// Decode reads the json field from, and files are opened from.
+	contextKeyUploads = contextKey("uploads")
+	// contextKeyAttachments is the context key for the files
+	// attached to the response, that Encode writes.
+	contextKeyAttachments = contextKey("attachments")
+	// contextKeyCompressMinBytes is the context key for the
+	// CompressMinBytes that Encode uses.
+	contextKeyCompressMinBytes = contextKey("compress-min-bytes")
+	// contextKeyService is the context key for the name of the
+	// service being called.
+	contextKeyService = contextKey("service")
+	// contextKeyMethod is the context key for the name of the
+	// method being called.
+	contextKeyMethod = contextKey("method")
+	// contextKeyMetadata is the context key for the Metadata sent
+	// by the client with the call being handled.
+	contextKeyMetadata = contextKey("metadata")
+	// contextKeyResponseMetadata is the context key for the
+	// responseMetadata that SetResponseMetadata sets.
+	contextKeyResponseMetadata = contextKey("response-metadata")
+	// contextKeyOutgoingMetadata is the context key for the Metadata
+	// that clients send with calls.
+	contextKeyOutgoingMetadata = contextKey("outgoing-metadata")
+	// contextKeyResponseMetadataReceiver is the context key for the
+	// Metadata that clients add response metadata to.
+	contextKeyResponseMetadataReceiver = contextKey("response-metadata-receiver")
+)
+
+// Batch calls fn for each of the n requests in a batch, using up to
+// Concurrency goroutines. Callers should store results by index, so
+// the order of responses matches the order of the requests.
+// If ctx is cancelled (for example, because the client disconnected),
+// no more requests are started and ctx.Err() is returned.
+func (srv *Server) Batch(ctx context.Context, n int, fn func(ctx context.Context, i int)) error {
+	workers := srv.Concurrency
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			fn(ctx, i)
+		}
+		return nil
+	}
+	var (
+		wg       sync.WaitGroup
+		panicked sync.Once
+		panicVal interface{}
+	)
+	items := make(chan int)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			defer func() {
+				// recover so the panic can be raised in the handler's
+				// goroutine, where net/http deals with it
+				if r := recover(); r != nil {
+					panicked.Do(func() { panicVal = r })
+					for range items {
+						// drain remaining items
+					}
+				}
+			}()
+			for i := range items {
+				fn(ctx, i)
+			}
+		}()
+	}
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case items <- i:
+		}
 	}
-	r = r.WithContext(remototypes.WithOpener(r.Context(), opener))
-	handler.ServeHTTP(w, r)
+	close(items)
+	wg.Wait()
+	if panicVal != nil {
+		panic(panicVal)
+	}
+	return err
 }
 
 // Describe an overview of the endpoints to the specified io.Writer.
@@ -68,8 +404,3 @@ func (srv *Server) Describe(w io.Writer) error {
 	})
 	return err
 }
-
-// Error is an error wrapper for repsonses.
-type Error struct {
-	Err error `json:"error"`
-}
@@ -2,14 +2,23 @@ package remotohttp_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 	"github.com/matryer/remoto/go/remotohttp"
+	"github.com/matryer/remoto/go/remotohttp/remototypes"
 )
 
 func TestServerServeHTTP(t *testing.T) {
@@ -64,3 +73,328 @@ func TestServerDescribe(t *testing.T) {
 	is.True(strings.Contains(s, "endpoint: /remoto/Service2.Method2"))
 	is.True(strings.Contains(s, "endpoint: /remoto/Service3.Method3"))
 }
+
+func TestServerMiddleware(t *testing.T) {
+	is := is.New(t)
+	var calls []string
+	middleware := func(name string) remotohttp.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				service, method, ok := remotohttp.MethodFromContext(r.Context())
+				is.True(ok)
+				calls = append(calls, name+":"+service+"."+method)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", h)
+	srv.Register("/remoto/Greeter.Farewell", h)
+	srv.Use(middleware("first"), middleware("second"))
+	srv.UseMethod("Greeter", "Greet", middleware("greet"))
+
+	req, err := http.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[]`))
+	is.NoErr(err)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	is.Equal(calls, []string{
+		"first:Greeter.Greet",
+		"second:Greeter.Greet",
+		"greet:Greeter.Greet",
+		"handler",
+	})
+
+	calls = nil
+	req, err = http.NewRequest(http.MethodPost, "/remoto/Greeter.Farewell", strings.NewReader(`[]`))
+	is.NoErr(err)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	is.Equal(calls, []string{
+		"first:Greeter.Farewell",
+		"second:Greeter.Farewell",
+		"handler",
+	})
+}
+
+func TestServerMiddlewareShortCircuit(t *testing.T) {
+	is := is.New(t)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	})
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", h)
+	srv.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	})
+	req, err := http.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[]`))
+	is.NoErr(err)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusUnauthorized)
+}
+
+func TestMethodFromContext(t *testing.T) {
+	is := is.New(t)
+	_, _, ok := remotohttp.MethodFromContext(context.Background())
+	is.Equal(ok, false)
+}
+
+func TestServerCall(t *testing.T) {
+	is := is.New(t)
+	var calls []string
+	interceptor := func(name string) remotohttp.Interceptor {
+		return func(ctx context.Context, info remotohttp.CallInfo, request interface{}, next remotohttp.CallHandler) (interface{}, error) {
+			calls = append(calls, name+":"+info.Service+"."+info.Method+":"+request.(string))
+			return next(ctx, request.(string)+"!")
+		}
+	}
+	srv := &remotohttp.Server{}
+	srv.Intercept(interceptor("first"), interceptor("second"))
+	info := remotohttp.CallInfo{Service: "Greeter", Method: "Greet"}
+	resp, err := srv.Call(context.Background(), info, "Mat", func(ctx context.Context, request interface{}) (interface{}, error) {
+		calls = append(calls, "handler:"+request.(string))
+		return "Hello " + request.(string), nil
+	})
+	is.NoErr(err)
+	is.Equal(resp, "Hello Mat!!")
+	is.Equal(calls, []string{
+		"first:Greeter.Greet:Mat",
+		"second:Greeter.Greet:Mat!",
+		"handler:Mat!!",
+	})
+}
+
+func TestServerCallInterceptorErr(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Intercept(func(ctx context.Context, info remotohttp.CallInfo, request interface{}, next remotohttp.CallHandler) (interface{}, error) {
+		return nil, errors.New("denied")
+	})
+	_, err := srv.Call(context.Background(), remotohttp.CallInfo{}, nil, func(ctx context.Context, request interface{}) (interface{}, error) {
+		t.Error("handler should not be called")
+		return nil, nil
+	})
+	is.Equal(err.Error(), "denied")
+}
+
+func TestServerNotFound(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+	req, err := http.NewRequest(http.MethodPost, "/remoto/Greeter.Nope", strings.NewReader(`[]`))
+	is.NoErr(err)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusNotFound)
+	is.Equal(w.Body.String(), `[{"error":"unknown endpoint: /remoto/Greeter.Nope","error_code":"not_found","error_details":null,"error_retryable":false}]`)
+
+	srv.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusTeapot)
+}
+
+func TestServerMethodNotAllowed(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+	req, err := http.NewRequest(http.MethodGet, "/remoto/Greeter.Greet", nil)
+	is.NoErr(err)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusMethodNotAllowed)
+	is.Equal(w.Header().Get("Allow"), http.MethodPost)
+	is.True(strings.Contains(w.Body.String(), `"error_code":"method_not_allowed"`))
+}
+
+func TestServerHandleErr(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	srv.HandleErr(w, r, remotohttp.Errorf(remotohttp.CodeInvalidArgument, "bad"))
+	is.Equal(w.Code, http.StatusBadRequest)
+	var called bool
+	srv.OnErr = func(w http.ResponseWriter, r *http.Request, err error) {
+		called = true
+	}
+	srv.HandleErr(httptest.NewRecorder(), r, errors.New("oops"))
+	is.True(called)
+}
+
+func TestServerBatch(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{Concurrency: 3}
+	var inflight, maxInflight int32
+	results := make([]int, 20)
+	err := srv.Batch(context.Background(), len(results), func(ctx context.Context, i int) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		results[i] = i * 2
+	})
+	is.NoErr(err)
+	is.True(atomic.LoadInt32(&maxInflight) <= 3)
+	is.True(atomic.LoadInt32(&maxInflight) > 1) // should run concurrently
+	for i := range results {
+		is.Equal(results[i], i*2) // results should be in order
+	}
+}
+
+func TestServerBatchSequential(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	var order []int
+	err := srv.Batch(context.Background(), 5, func(ctx context.Context, i int) {
+		order = append(order, i)
+	})
+	is.NoErr(err)
+	is.Equal(order, []int{0, 1, 2, 3, 4})
+}
+
+func TestServerBatchCancel(t *testing.T) {
+	is := is.New(t)
+	for _, concurrency := range []int{0, 2} {
+		srv := &remotohttp.Server{Concurrency: concurrency}
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int32
+		err := srv.Batch(ctx, 100, func(ctx context.Context, i int) {
+			if atomic.AddInt32(&calls, 1) == 2 {
+				cancel()
+			}
+		})
+		is.Equal(err, context.Canceled)
+		is.True(atomic.LoadInt32(&calls) < 100) // remaining items should be skipped
+	}
+}
+
+func TestServerBatchPanic(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{Concurrency: 4}
+	defer func() {
+		is.Equal(recover(), "boom")
+	}()
+	srv.Batch(context.Background(), 10, func(ctx context.Context, i int) {
+		if i == 3 {
+			panic("boom")
+		}
+	})
+	t.Error("expected panic")
+}
+
+func TestServerLimits(t *testing.T) {
+	is := is.New(t)
+	type greetRequest struct {
+		Name  string `json:"name"`
+		Photo struct {
+			Fieldname string `json:"fieldname"`
+		} `json:"photo"`
+	}
+	multipartBody := func(json string, files ...string) (string, *bytes.Buffer) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("json", json)
+		for i, contents := range files {
+			f, err := w.CreateFormFile(fmt.Sprintf("files[%d]", i), "file.txt")
+			is.NoErr(err)
+			io.WriteString(f, contents)
+		}
+		is.NoErr(w.Close())
+		return w.FormDataContentType(), &buf
+	}
+	for _, test := range []struct {
+		name   string
+		srv    *remotohttp.Server
+		json   string
+		files  []string
+		status int
+		err    string
+	}{
+		{
+			name:   "within limits",
+			srv:    &remotohttp.Server{MaxBodyBytes: 1 << 20, MaxBatchSize: 2, MaxFileSize: 5, MaxFiles: 1},
+			json:   `[{"name":"Mat","photo":{"fieldname":"files[0]"}}]`,
+			files:  []string{"12345"},
+			status: http.StatusOK,
+		},
+		{
+			name:   "body too large",
+			srv:    &remotohttp.Server{MaxBodyBytes: 10},
+			json:   `[{"name":"Mat"}]`,
+			status: http.StatusRequestEntityTooLarge,
+			err:    "request body too large (limit is 10 bytes)",
+		},
+		{
+			name:   "batch too large",
+			srv:    &remotohttp.Server{MaxBatchSize: 2},
+			json:   `[{"name":"Mat"},{"name":"David"},{"name":"Aaron"}]`,
+			status: http.StatusRequestEntityTooLarge,
+			err:    "too many requests in batch: 3 (limit is 2)",
+		},
+		{
+			name:   "file too large",
+			srv:    &remotohttp.Server{MaxFileSize: 5},
+			json:   `[{"name":"Mat","photo":{"fieldname":"files[0]"}}]`,
+			files:  []string{"123456"},
+			status: http.StatusRequestEntityTooLarge,
+			err:    "file files[0] too large (limit is 5 bytes)",
+		},
+		{
+			name:   "too many files",
+			srv:    &remotohttp.Server{MaxFiles: 1},
+			json:   `[{"name":"Mat","photo":{"fieldname":"files[1]"}}]`,
+			files:  []string{"1", "2"},
+			status: http.StatusRequestEntityTooLarge,
+			err:    "too many files: 2 (limit is 1)",
+		},
+	} {
+		test.srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqs []greetRequest
+			if err := remotohttp.Decode(r, &reqs); err != nil {
+				remotohttp.EncodeErr(w, r, err)
+				return
+			}
+			if reqs[0].Photo.Fieldname != "" {
+				f, err := remototypes.File{Fieldname: reqs[0].Photo.Fieldname}.Open(r.Context())
+				if err != nil {
+					remotohttp.EncodeErr(w, r, err)
+					return
+				}
+				defer f.Close()
+				if _, err := ioutil.ReadAll(f); err != nil {
+					remotohttp.EncodeErr(w, r, err)
+					return
+				}
+			}
+			remotohttp.Encode(w, r, http.StatusOK, []struct{}{{}})
+		}))
+		contentType, body := multipartBody(test.json, test.files...)
+		req, err := http.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", body)
+		is.NoErr(err)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		test.srv.ServeHTTP(w, req)
+		is.Equal(w.Code, test.status) // test.name
+		if test.err != "" {
+			var resps []remotohttp.ErrorResponse
+			is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+			is.Equal(resps[0].Error, test.err) // test.name
+			is.Equal(resps[0].ErrorCode, remotohttp.CodeRequestTooLarge)
+		}
+	}
+}
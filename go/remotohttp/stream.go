@@ -0,0 +1,314 @@
+package remotohttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StreamBatch calls fn for each of the n requests in a batch (see Batch),
+// and writes the responses to w as a JSON array. Each response is written
+// as soon as it, and all of the responses before it, are ready, so
+// large batches are not held in memory.
+// Requests that are not started because ctx was cancelled get an error
+// response, so the array always contains n responses.
+// Errors are only returned if the responses could not be written.
+// Responses are only streamed as JSON; if the request Accepts another
+// codec (see Negotiate), they are written with Encode when they are
+// all ready. Batches of a single request are also written with Encode,
+// so metadata set by the service (see SetResponseMetadata) is sent in
+// headers rather than trailers.
+func (srv *Server) StreamBatch(w http.ResponseWriter, r *http.Request, n int, fn func(ctx context.Context, i int) interface{}) error {
+	if codec := Negotiate(r); codec != JSON || n == 1 {
+		return srv.encodeBatch(w, r, n, fn)
+	}
+	var out io.Writer = w
+	flush := func() error {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if _, ok := compressMinBytes(r); ok && acceptEncoding(r) != "" {
+		// the size is not known yet, so batches are always compressed
+		encoding := acceptEncoding(r)
+		cw, err := newCompressor(w, encoding)
+		if err != nil {
+			return errors.Wrap(err, "compress response")
+		}
+		defer cw.Close() // for errors, Close is called again below
+		w.Header().Set("Content-Encoding", encoding)
+		out = cw
+		flush = func() error {
+			if err := cw.Flush(); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		}
+	}
+	enc := &arrayEncoder{
+		w:     out,
+		flush: flush,
+		enc:   json.NewEncoder(out),
+		resps: make([]interface{}, n),
+		ready: make([]bool, n),
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(out, "["); err != nil {
+		return err
+	}
+	batchErr := srv.Batch(r.Context(), n, func(ctx context.Context, i int) {
+		enc.set(i, fn(ctx, i))
+	})
+	if batchErr != nil {
+		for i := 0; i < n; i++ {
+			enc.setDefault(i, NewErrorResponse(batchErr))
+		}
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+	if _, err := io.WriteString(out, "]"); err != nil {
+		return err
+	}
+	if cw, ok := out.(compressor); ok {
+		return cw.Close()
+	}
+	return nil
+}
+
+// encodeBatch calls fn for each of the n requests in a batch, and
+// writes the responses with Encode.
+func (srv *Server) encodeBatch(w http.ResponseWriter, r *http.Request, n int, fn func(ctx context.Context, i int) interface{}) error {
+	resps := make([]interface{}, n)
+	batchErr := srv.Batch(r.Context(), n, func(ctx context.Context, i int) {
+		resps[i] = fn(ctx, i)
+	})
+	if batchErr != nil {
+		for i := range resps {
+			if resps[i] == nil {
+				resps[i] = NewErrorResponse(batchErr)
+			}
+		}
+	}
+	return Encode(w, r, http.StatusOK, resps)
+}
+
+// arrayEncoder writes the elements of a JSON array in order, as they
+// become ready.
+type arrayEncoder struct {
+	w     io.Writer
+	flush func() error
+	enc   *json.Encoder
+
+	mu    sync.Mutex
+	resps []interface{}
+	ready []bool
+	next  int
+	err   error
+}
+
+// set sets the response at index i, and writes any responses that
+// are ready.
+func (e *arrayEncoder) set(i int, resp interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resps[i] = resp
+	e.ready[i] = true
+	e.write()
+}
+
+// setDefault sets the response at index i if it has not already
+// been set.
+func (e *arrayEncoder) setDefault(i int, resp interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ready[i] {
+		return
+	}
+	e.resps[i] = resp
+	e.ready[i] = true
+	e.write()
+}
+
+// write writes the ready responses. The caller must hold e.mu.
+func (e *arrayEncoder) write() {
+	start := e.next
+	for e.next < len(e.ready) && e.ready[e.next] {
+		resp := e.resps[e.next]
+		e.resps[e.next] = nil // release the memory
+		if e.err == nil && e.next > 0 {
+			_, e.err = io.WriteString(e.w, ",")
+		}
+		if e.err == nil {
+			e.err = errors.Wrap(e.enc.Encode(resp), "encode json")
+		}
+		e.next++
+	}
+	if e.next > start && e.err == nil {
+		e.err = e.flush()
+	}
+}
+
+// ArrayDecoder decodes the elements of a JSON array one at a time,
+// from a response body.
+type ArrayDecoder struct {
+	body    io.ReadCloser
+	dec     *json.Decoder
+	started bool
+	err     error
+}
+
+// NewArrayDecoder makes a new ArrayDecoder that reads from body.
+// Callers must call Close.
+func NewArrayDecoder(body io.ReadCloser) *ArrayDecoder {
+	return &ArrayDecoder{
+		body: body,
+		dec:  json.NewDecoder(body),
+	}
+}
+
+// More gets whether there is another element in the array.
+func (d *ArrayDecoder) More() bool {
+	if d.err != nil {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		tok, err := d.dec.Token()
+		if err != nil {
+			d.err = errors.Wrap(err, "decode json")
+			return false
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			d.err = errors.New("decode json: expected array")
+			return false
+		}
+	}
+	return d.dec.More()
+}
+
+// Decode decodes the next element into v.
+func (d *ArrayDecoder) Decode(v interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.dec.Decode(v); err != nil {
+		d.err = errors.Wrap(err, "decode json")
+		return d.err
+	}
+	return nil
+}
+
+// Err gets the error that stopped decoding, if any.
+func (d *ArrayDecoder) Err() error {
+	return d.err
+}
+
+// Close closes the underlying body.
+func (d *ArrayDecoder) Close() error {
+	return d.body.Close()
+}
+
+// ResponseDecoder decodes a sequence of responses.
+// ArrayDecoder and StreamDecoder are ResponseDecoders.
+type ResponseDecoder interface {
+	// More gets whether there is another response.
+	More() bool
+	// Decode decodes the next response into v.
+	Decode(v interface{}) error
+	// Err gets the error that stopped decoding, if any.
+	Err() error
+	// Close closes the underlying body.
+	Close() error
+}
+
+// StreamWriter writes the responses of a streaming method as
+// newline delimited JSON (NDJSON), flushing after each one so clients
+// receive them immediately.
+type StreamWriter struct {
+	w   http.ResponseWriter
+	enc *json.Encoder
+}
+
+// NewStreamWriter makes a new StreamWriter, and writes the response
+// headers.
+func NewStreamWriter(w http.ResponseWriter) *StreamWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return &StreamWriter{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Send writes a response.
+func (s *StreamWriter) Send(v interface{}) error {
+	if err := s.enc.Encode(v); err != nil {
+		return errors.Wrap(err, "encode json")
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// StreamDecoder decodes newline delimited JSON (NDJSON) responses,
+// one at a time, from the body of a streaming method.
+type StreamDecoder struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+	err  error
+}
+
+// NewStreamDecoder makes a new StreamDecoder that reads from body.
+// Callers must call Close.
+func NewStreamDecoder(body io.ReadCloser) *StreamDecoder {
+	return &StreamDecoder{
+		body: body,
+		dec:  json.NewDecoder(body),
+	}
+}
+
+// More gets whether there is another response in the stream.
+func (d *StreamDecoder) More() bool {
+	if d.err != nil {
+		return false
+	}
+	return d.dec.More()
+}
+
+// Decode decodes the next response into v.
+func (d *StreamDecoder) Decode(v interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.dec.Decode(v); err != nil {
+		d.err = errors.Wrap(err, "decode json")
+		return d.err
+	}
+	return nil
+}
+
+// Err gets the error that stopped decoding, if any.
+func (d *StreamDecoder) Err() error {
+	return d.err
+}
+
+// Close closes the underlying body.
+func (d *StreamDecoder) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,131 @@
+package remotohttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+func TestStreamBatch(t *testing.T) {
+	is := is.New(t)
+	type greetResponse struct {
+		Greeting string `json:"greeting"`
+	}
+	srv := &remotohttp.Server{Concurrency: 4}
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil)
+	w := httptest.NewRecorder()
+	err := srv.StreamBatch(w, r, 5, func(ctx context.Context, i int) interface{} {
+		// later requests finish first
+		time.Sleep(time.Duration(5-i) * time.Millisecond)
+		return greetResponse{Greeting: strings.Repeat("!", i)}
+	})
+	is.NoErr(err)
+	is.Equal(w.Code, http.StatusOK)
+	is.True(w.Flushed)
+	var resps []greetResponse
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(len(resps), 5)
+	for i := range resps {
+		is.Equal(resps[i].Greeting, strings.Repeat("!", i)) // responses should be in order
+	}
+}
+
+func TestStreamBatchEmpty(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil)
+	w := httptest.NewRecorder()
+	err := srv.StreamBatch(w, r, 0, func(ctx context.Context, i int) interface{} {
+		t.Error("fn should not be called")
+		return nil
+	})
+	is.NoErr(err)
+	is.Equal(w.Body.String(), `[]`)
+}
+
+func TestStreamBatchCancel(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	err := srv.StreamBatch(w, r, 3, func(ctx context.Context, i int) interface{} {
+		cancel()
+		return remotohttp.ErrorResponse{}
+	})
+	is.NoErr(err)
+	var resps []remotohttp.ErrorResponse
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &resps))
+	is.Equal(len(resps), 3) // every request should get a response
+	is.Equal(resps[0].ErrorCode, "")
+	is.Equal(resps[1].ErrorCode, remotohttp.CodeCanceled)
+	is.Equal(resps[2].ErrorCode, remotohttp.CodeCanceled)
+}
+
+func TestArrayDecoder(t *testing.T) {
+	is := is.New(t)
+	body := ioutil.NopCloser(strings.NewReader(`[{"greeting":"Hello Mat"}, {"greeting":"Hello David"}]`))
+	dec := remotohttp.NewArrayDecoder(body)
+	defer dec.Close()
+	var greetings []string
+	for dec.More() {
+		var resp struct {
+			Greeting string `json:"greeting"`
+		}
+		is.NoErr(dec.Decode(&resp))
+		greetings = append(greetings, resp.Greeting)
+	}
+	is.NoErr(dec.Err())
+	is.Equal(greetings, []string{"Hello Mat", "Hello David"})
+}
+
+func TestArrayDecoderErr(t *testing.T) {
+	is := is.New(t)
+	dec := remotohttp.NewArrayDecoder(ioutil.NopCloser(strings.NewReader(`{"error":"not an array"}`)))
+	is.Equal(dec.More(), false)
+	is.True(dec.Err() != nil)
+}
+
+func TestStreamWriter(t *testing.T) {
+	is := is.New(t)
+	w := httptest.NewRecorder()
+	stream := remotohttp.NewStreamWriter(w)
+	is.NoErr(stream.Send(map[string]string{"change": "one"}))
+	is.NoErr(stream.Send(map[string]string{"change": "two"}))
+	is.Equal(w.Header().Get("Content-Type"), "application/x-ndjson")
+	is.True(w.Flushed)
+	is.Equal(w.Body.String(), "{\"change\":\"one\"}\n{\"change\":\"two\"}\n")
+
+	var dec remotohttp.ResponseDecoder = remotohttp.NewStreamDecoder(ioutil.NopCloser(w.Body))
+	defer dec.Close()
+	var changes []string
+	for dec.More() {
+		var resp struct {
+			Change string `json:"change"`
+		}
+		is.NoErr(dec.Decode(&resp))
+		changes = append(changes, resp.Change)
+	}
+	is.NoErr(dec.Err())
+	is.Equal(changes, []string{"one", "two"})
+}
+
+func TestStreamDecoderErr(t *testing.T) {
+	is := is.New(t)
+	dec := remotohttp.NewStreamDecoder(ioutil.NopCloser(strings.NewReader("{\"change\":\"one\"}\n{\"chan")))
+	var resp struct{}
+	is.True(dec.More())
+	is.NoErr(dec.Decode(&resp))
+	is.True(dec.More())
+	is.True(dec.Decode(&resp) != nil)
+	is.Equal(dec.More(), false)
+	is.True(dec.Err() != nil)
+}
@@ -0,0 +1,76 @@
+package remotohttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// TimeoutHeader is the header that clients send the time left until
+// the deadline of a call in, as a duration like "1.5s" or "250ms"
+// (see time.ParseDuration). The server cancels the context of the call
+// when the time is up, so it stops working on calls that the client
+// has given up on.
+const TimeoutHeader = MetadataHeaderPrefix + "Timeout"
+
+// Timeout limits how long calls may take.
+type Timeout struct {
+	// Default is the timeout for calls when the client does not send
+	// a deadline. Zero means no timeout.
+	Default time.Duration
+	// Max is the longest timeout that clients may ask for. Longer
+	// timeouts, and calls with no timeout, are given Max instead.
+	// Zero means no limit.
+	Max time.Duration
+}
+
+// TimeoutMethod sets the Timeout for calls to the specified method,
+// instead of the Timeout of the Server, e.g.
+// TimeoutMethod("Images", "Resize", remotohttp.Timeout{Max: time.Minute}).
+func (srv *Server) TimeoutMethod(service, method string, timeout Timeout) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.methodTimeouts == nil {
+		srv.methodTimeouts = make(map[string]Timeout)
+	}
+	srv.methodTimeouts[service+"."+method] = timeout
+}
+
+// timeout gets the timeout for a call to the method, from the
+// TimeoutHeader of the request and the Timeout for the method. Zero
+// means no timeout.
+func (srv *Server) timeout(service, method string, r *http.Request) (time.Duration, error) {
+	srv.mu.RLock()
+	t, ok := srv.methodTimeouts[service+"."+method]
+	srv.mu.RUnlock()
+	if !ok {
+		t = srv.Timeout
+	}
+	timeout := t.Default
+	if v := r.Header.Get(TimeoutHeader); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, Errorf(CodeInvalidArgument, "invalid %s header: %q", TimeoutHeader, v)
+		}
+		timeout = d
+	}
+	if t.Max > 0 && (timeout == 0 || timeout > t.Max) {
+		timeout = t.Max
+	}
+	return timeout, nil
+}
+
+// SetTimeoutHeader sets the TimeoutHeader of req to the time left until
+// the deadline of its context, if it has one.
+// Generated clients call this before each request is made.
+func SetTimeoutHeader(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	timeout := time.Until(deadline).Round(time.Millisecond)
+	if timeout < time.Millisecond {
+		// the deadline has passed, so the request will be cancelled
+		timeout = time.Millisecond
+	}
+	req.Header.Set(TimeoutHeader, timeout.String())
+}
@@ -0,0 +1,129 @@
+package remotohttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+func TestTimeout(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		timeout       remotohttp.Timeout
+		methodTimeout *remotohttp.Timeout
+		header        string
+		want          time.Duration // zero means no deadline
+		code          string
+	}{
+		{name: "none"},
+		{name: "header", header: "50ms", want: 50 * time.Millisecond},
+		{name: "default", timeout: remotohttp.Timeout{Default: time.Minute}, want: time.Minute},
+		{name: "header overrides default", timeout: remotohttp.Timeout{Default: time.Minute}, header: "1s", want: time.Second},
+		{name: "max", timeout: remotohttp.Timeout{Max: time.Minute}, want: time.Minute},
+		{name: "header over max", timeout: remotohttp.Timeout{Max: time.Minute}, header: "1h", want: time.Minute},
+		{name: "method", timeout: remotohttp.Timeout{Default: time.Hour}, methodTimeout: &remotohttp.Timeout{Default: time.Minute}, want: time.Minute},
+		{name: "invalid header", header: "soon", code: remotohttp.CodeInvalidArgument},
+		{name: "negative header", header: "-1s", code: remotohttp.CodeInvalidArgument},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			srv := &remotohttp.Server{Timeout: test.timeout}
+			if test.methodTimeout != nil {
+				srv.TimeoutMethod("Greeter", "Greet", *test.methodTimeout)
+			}
+			var (
+				deadline    time.Time
+				hasDeadline bool
+			)
+			srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, hasDeadline = r.Context().Deadline()
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[{}]`))
+			if test.header != "" {
+				r.Header.Set(remotohttp.TimeoutHeader, test.header)
+			}
+			w := httptest.NewRecorder()
+			start := time.Now()
+			srv.ServeHTTP(w, r)
+			end := time.Now()
+			if test.code != "" {
+				is.Equal(w.Code, http.StatusBadRequest)
+				is.Equal(remotohttp.AsError(remotohttp.ResponseErr(w.Result())).Code, test.code)
+				return
+			}
+			is.Equal(w.Code, http.StatusOK)
+			is.Equal(hasDeadline, test.want > 0)
+			if hasDeadline {
+				is.True(!deadline.Before(start.Add(test.want)))
+				is.True(!deadline.After(end.Add(test.want)))
+			}
+		})
+	}
+}
+
+func TestTimeoutCancels(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			remotohttp.EncodeErr(w, r, r.Context().Err())
+		case <-time.After(10 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/remoto/Greeter.Greet", strings.NewReader(`[{}]`))
+	r.Header.Set(remotohttp.TimeoutHeader, "10ms")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	is.Equal(w.Code, http.StatusGatewayTimeout)
+	is.Equal(remotohttp.AsError(remotohttp.ResponseErr(w.Result())).Code, remotohttp.CodeDeadlineExceeded)
+}
+
+func TestSetTimeoutHeader(t *testing.T) {
+	is := is.New(t)
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/remoto/Greeter.Greet", nil)
+	is.NoErr(err)
+	remotohttp.SetTimeoutHeader(req)
+	is.Equal(req.Header.Get(remotohttp.TimeoutHeader), "") // no deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req = req.WithContext(ctx)
+	remotohttp.SetTimeoutHeader(req)
+	timeout, err := time.ParseDuration(req.Header.Get(remotohttp.TimeoutHeader))
+	is.NoErr(err)
+	is.True(timeout > time.Second)
+	is.True(timeout <= 2*time.Second)
+}
+
+func TestTimeoutWebSocket(t *testing.T) {
+	is := is.New(t)
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		remotohttp.Encode(w, r, http.StatusOK, []bool{ok})
+	}))
+	s := httptest.NewServer(http.HandlerFunc(srv.ServeWebSocket))
+	defer s.Close()
+	transport, err := remotohttp.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	defer transport.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/remoto/Greeter.Greet", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+	remotohttp.SetTimeoutHeader(req)
+	resp, err := transport.RoundTrip(req)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(strings.TrimSpace(string(readAll(t, resp))), `[true]`) // the timeout is sent with the call
+}
@@ -0,0 +1,279 @@
+package remotohttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UploadInfo describes a resumable upload (see Server.ServeUploads).
+type UploadInfo struct {
+	// ID is the unique ID of the upload.
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	// Size is the size of the file in bytes, if it was given when the
+	// upload was created, or once the upload is complete.
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the file, if it was
+	// given when the upload was created.
+	SHA256 string `json:"sha256,omitempty"`
+	// Offset is the number of bytes that have been uploaded, which is
+	// where the next chunk must be written.
+	Offset int64 `json:"offset"`
+	// Complete is whether the upload has been completed, after which
+	// no more chunks can be written.
+	Complete bool      `json:"complete"`
+	Created  time.Time `json:"created"`
+}
+
+// UploadStore stores resumable uploads. Methods that are given the ID
+// of an upload that does not exist return an *Error with CodeNotFound.
+type UploadStore interface {
+	// Create creates a new upload, and gets it with its ID set.
+	Create(ctx context.Context, info UploadInfo) (UploadInfo, error)
+	// Get gets the upload.
+	Get(ctx context.Context, id string) (UploadInfo, error)
+	// Write appends the chunk read from r to the upload. If offset
+	// is not the Offset of the upload, or another chunk is being
+	// written, the error is an *Error with CodeAborted. The upload is
+	// returned even if reading r fails part way through, with the
+	// Offset after the bytes that were written.
+	Write(ctx context.Context, id string, offset int64, r io.Reader) (UploadInfo, error)
+	// Complete marks the upload as complete, and sets its Size.
+	Complete(ctx context.Context, id string) (UploadInfo, error)
+	// Open opens the file that has been uploaded.
+	// Callers must close the file.
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Delete deletes the upload.
+	Delete(ctx context.Context, id string) error
+}
+
+// DiskUploadStore is an UploadStore that keeps uploads in a directory
+// on the local disk. Uploads are kept until they are deleted, or until
+// they are removed by Expire.
+type DiskUploadStore struct {
+	// Dir is the directory to keep uploads in. It is created if it
+	// does not exist.
+	Dir string
+
+	mu sync.Mutex
+	// writing are the IDs of the uploads that chunks are being
+	// written to.
+	writing map[string]bool
+}
+
+var _ UploadStore = (*DiskUploadStore)(nil)
+
+// Create creates a new upload.
+func (s *DiskUploadStore) Create(ctx context.Context, info UploadInfo) (UploadInfo, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return UploadInfo{}, errors.Wrap(err, "create upload")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return UploadInfo{}, errors.Wrap(err, "create upload")
+	}
+	info.ID = hex.EncodeToString(b)
+	info.Offset = 0
+	info.Complete = false
+	info.Created = time.Now().UTC()
+	f, err := os.OpenFile(s.path(info.ID, ".data"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return UploadInfo{}, errors.Wrap(err, "create upload")
+	}
+	if err := f.Close(); err != nil {
+		return UploadInfo{}, errors.Wrap(err, "create upload")
+	}
+	if err := s.save(info); err != nil {
+		os.Remove(s.path(info.ID, ".data"))
+		return UploadInfo{}, err
+	}
+	return info, nil
+}
+
+// Get gets the upload.
+func (s *DiskUploadStore) Get(ctx context.Context, id string) (UploadInfo, error) {
+	if !validUploadID(id) {
+		return UploadInfo{}, Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	b, err := ioutil.ReadFile(s.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return UploadInfo{}, Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	if err != nil {
+		return UploadInfo{}, errors.Wrap(err, "read upload")
+	}
+	var info UploadInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return UploadInfo{}, errors.Wrap(err, "read upload")
+	}
+	stat, err := os.Stat(s.path(id, ".data"))
+	if os.IsNotExist(err) {
+		return UploadInfo{}, Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	if err != nil {
+		return UploadInfo{}, errors.Wrap(err, "read upload")
+	}
+	info.Offset = stat.Size()
+	return info, nil
+}
+
+// Write appends the chunk read from r to the upload.
+func (s *DiskUploadStore) Write(ctx context.Context, id string, offset int64, r io.Reader) (UploadInfo, error) {
+	s.mu.Lock()
+	if s.writing[id] {
+		s.mu.Unlock()
+		return UploadInfo{}, Errorf(CodeAborted, "upload %s: another chunk is being written", id)
+	}
+	if s.writing == nil {
+		s.writing = make(map[string]bool)
+	}
+	s.writing[id] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.writing, id)
+		s.mu.Unlock()
+	}()
+	info, err := s.Get(ctx, id)
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	if info.Complete {
+		return UploadInfo{}, Errorf(CodeAborted, "upload %s is complete", id)
+	}
+	if offset != info.Offset {
+		return UploadInfo{}, Errorf(CodeAborted, "upload %s is at offset %d, not %d", id, info.Offset, offset)
+	}
+	f, err := os.OpenFile(s.path(id, ".data"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return UploadInfo{}, errors.Wrap(err, "write upload")
+	}
+	n, err := io.Copy(f, r)
+	info.Offset += n
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "write upload")
+	}
+	return info, err
+}
+
+// Complete marks the upload as complete.
+func (s *DiskUploadStore) Complete(ctx context.Context, id string) (UploadInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writing[id] {
+		return UploadInfo{}, Errorf(CodeAborted, "upload %s: a chunk is being written", id)
+	}
+	info, err := s.Get(ctx, id)
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	info.Complete = true
+	info.Size = info.Offset
+	if err := s.save(info); err != nil {
+		return UploadInfo{}, err
+	}
+	return info, nil
+}
+
+// Open opens the file that has been uploaded.
+func (s *DiskUploadStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	if !validUploadID(id) {
+		return nil, Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	f, err := os.Open(s.path(id, ".data"))
+	if os.IsNotExist(err) {
+		return nil, Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "open upload")
+	}
+	return f, nil
+}
+
+// Delete deletes the upload.
+func (s *DiskUploadStore) Delete(ctx context.Context, id string) error {
+	if !validUploadID(id) {
+		return Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	err := os.Remove(s.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return Errorf(CodeNotFound, "no such upload: %s", id)
+	}
+	if err != nil {
+		return errors.Wrap(err, "delete upload")
+	}
+	if err := os.Remove(s.path(id, ".data")); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "delete upload")
+	}
+	return nil
+}
+
+// Expire deletes the uploads that were created more than maxAge ago.
+// Call it periodically to remove uploads that were abandoned, or have
+// been used.
+func (s *DiskUploadStore) Expire(ctx context.Context, maxAge time.Duration) error {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return errors.Wrap(err, "expire uploads")
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		info, err := s.Get(ctx, id)
+		if err != nil {
+			continue // deleted, or not an upload
+		}
+		if info.Created.Before(cutoff) {
+			if err := s.Delete(ctx, id); err != nil && AsError(err).Code != CodeNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save writes the info about the upload.
+func (s *DiskUploadStore) save(info UploadInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "save upload")
+	}
+	// write to a temporary file first, so the info is never
+	// partially written
+	tmp := s.path(info.ID, ".json.tmp")
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, "save upload")
+	}
+	if err := os.Rename(tmp, s.path(info.ID, ".json")); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "save upload")
+	}
+	return nil
+}
+
+// path gets the path of the file for the upload with the extension.
+func (s *DiskUploadStore) path(id, ext string) string {
+	return filepath.Join(s.Dir, id+ext)
+}
+
+// validUploadID gets whether id could be the ID of an upload. IDs are
+// checked before they are used in paths.
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
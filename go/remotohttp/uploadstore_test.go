@@ -0,0 +1,68 @@
+package remotohttp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+func TestDiskUploadStore(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	store := &remotohttp.DiskUploadStore{Dir: t.TempDir() + "/uploads"}
+	info, err := store.Create(ctx, remotohttp.UploadInfo{Filename: "file.txt", Size: 8})
+	is.NoErr(err)
+	is.Equal(len(info.ID), 32)
+	is.Equal(info.Offset, int64(0))
+	info, err = store.Write(ctx, info.ID, 0, strings.NewReader("cont"))
+	is.NoErr(err)
+	is.Equal(info.Offset, int64(4))
+	_, err = store.Write(ctx, info.ID, 0, strings.NewReader("cont"))
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeAborted) // wrong offset
+	_, err = store.Write(ctx, info.ID, 4, strings.NewReader("ents"))
+	is.NoErr(err)
+	info, err = store.Get(ctx, info.ID)
+	is.NoErr(err)
+	is.Equal(info.Filename, "file.txt")
+	is.Equal(info.Offset, int64(8))
+	is.Equal(info.Complete, false)
+	info, err = store.Complete(ctx, info.ID)
+	is.NoErr(err)
+	is.Equal(info.Complete, true)
+	is.Equal(info.Size, int64(8))
+	_, err = store.Write(ctx, info.ID, 8, strings.NewReader("more"))
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeAborted) // complete
+	f, err := store.Open(ctx, info.ID)
+	is.NoErr(err)
+	b, err := ioutil.ReadAll(f)
+	is.NoErr(err)
+	f.Close()
+	is.Equal(string(b), "contents")
+	is.NoErr(store.Delete(ctx, info.ID))
+	_, err = store.Get(ctx, info.ID)
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeNotFound)
+	_, err = store.Open(ctx, "../../etc/passwd")
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeNotFound)
+}
+
+func TestDiskUploadStoreExpire(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	store := &remotohttp.DiskUploadStore{Dir: t.TempDir()}
+	info, err := store.Create(ctx, remotohttp.UploadInfo{Filename: "file.txt"})
+	is.NoErr(err)
+	is.NoErr(store.Expire(ctx, time.Hour))
+	_, err = store.Get(ctx, info.ID)
+	is.NoErr(err) // not old enough to expire
+	is.NoErr(store.Expire(ctx, -time.Second))
+	_, err = store.Get(ctx, info.ID)
+	is.Equal(remotohttp.AsError(err).Code, remotohttp.CodeNotFound)
+	files, err := ioutil.ReadDir(store.Dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+}
@@ -0,0 +1,615 @@
+package remotohttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// WebSocketPath is the conventional path for the WebSocket transport.
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/remoto/", server)
+//	mux.HandleFunc(remotohttp.WebSocketPath, server.ServeWebSocket)
+const WebSocketPath = "/remoto/websocket"
+
+// DefaultWebSocketConcurrency is the number of calls that can be in
+// progress on a WebSocket connection at once, if Server.Concurrency
+// is zero.
+const DefaultWebSocketConcurrency = 16
+
+// WebSocketMessage is a message sent over a WebSocket connection.
+// Many calls can be in progress on the same connection at once, and
+// each is identified by an ID chosen by the client.
+//
+// To make a call, clients send a message with the ID, Service, Method
+// and Payload (the JSON array of requests). To cancel a call, clients
+// send a message with the ID and Cancel set.
+//
+// The server replies with one or more messages with the same ID, and
+// the HTTP Status of the call. The Payload is the JSON array of
+// responses, or a single response for streaming methods, which get a
+// message for each response. Done is set on the last message.
+//
+// Metadata sent by the client with a call is added to the metadata
+// from the headers of the upgrade request. The server sends the
+// response metadata set before the response started in the first
+// message of a call, and any set after it in the last.
+type WebSocketMessage struct {
+	ID       string          `json:"id"`
+	Service  string          `json:"service,omitempty"`
+	Method   string          `json:"method,omitempty"`
+	Status   int             `json:"status,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Metadata Metadata        `json:"metadata,omitempty"`
+	Done     bool            `json:"done,omitempty"`
+	Cancel   bool            `json:"cancel,omitempty"`
+}
+
+// ServeWebSocket upgrades the request to a WebSocket connection, and
+// handles the calls sent over it (see WebSocketMessage) until it
+// is closed.
+// Each call is handled by ServeHTTP, so middleware, interceptors and
+// limits apply as they do to HTTP requests. The headers of the upgrade
+// request (like Authorization) are copied to every call.
+// Files cannot be sent or received over WebSocket connections.
+//
+// Messages larger than MaxBodyBytes close the connection. Up to
+// Concurrency calls (or DefaultWebSocketConcurrency if it is zero) can
+// be in progress on a connection at once; more calls get an error with
+// CodeResourceExhausted.
+func (srv *Server) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: srv.CheckOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has written an error response
+	}
+	if srv.MaxBodyBytes > 0 {
+		conn.SetReadLimit(srv.MaxBodyBytes)
+	}
+	concurrency := srv.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultWebSocketConcurrency
+	}
+	c := &wsServerConn{
+		conn:  conn,
+		calls: make(map[string]context.CancelFunc),
+		sem:   make(chan struct{}, concurrency),
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	var wg sync.WaitGroup
+	for {
+		var msg WebSocketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			break
+		}
+		if msg.Cancel {
+			c.cancel(msg.ID)
+			continue
+		}
+		select {
+		case c.sem <- struct{}{}:
+		default:
+			c.sendErr(msg.ID, &Error{
+				Code:      CodeResourceExhausted,
+				Message:   fmt.Sprintf("too many calls in progress (max %d)", concurrency),
+				Retryable: true,
+			})
+			continue
+		}
+		callCtx, callCancel := context.WithCancel(ctx)
+		if !c.start(msg.ID, callCancel) {
+			callCancel()
+			<-c.sem
+			c.sendErr(msg.ID, Errorf(CodeInvalidArgument, "call %q is already in progress", msg.ID))
+			continue
+		}
+		wg.Add(1)
+		go func(msg WebSocketMessage) {
+			defer wg.Done()
+			defer func() { <-c.sem }()
+			defer c.cancel(msg.ID)
+			srv.serveWebSocketCall(callCtx, r, c, msg)
+		}(msg)
+	}
+	cancel()
+	wg.Wait()
+	conn.Close()
+}
+
+// serveWebSocketCall handles a single call with ServeHTTP.
+func (srv *Server) serveWebSocketCall(ctx context.Context, r *http.Request, c *wsServerConn, msg WebSocketMessage) {
+	path := "/remoto/" + msg.Service + "." + msg.Method
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(msg.Payload))
+	if err != nil {
+		c.sendErr(msg.ID, Errorf(CodeNotFound, "unknown endpoint: %s", path))
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header = r.Header.Clone()
+	for _, header := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol", "Accept-Encoding", "Content-Encoding"} {
+		req.Header.Del(header)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	setMetadata(req.Header, msg.Metadata)
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+	w := &wsResponseWriter{
+		id:     msg.ID,
+		conn:   c,
+		header: make(http.Header),
+	}
+	srv.ServeHTTP(w, req)
+	w.finish()
+}
+
+// wsServerConn is the server side of a WebSocket connection.
+type wsServerConn struct {
+	conn *websocket.Conn
+	// writeMu serializes writes to conn.
+	writeMu sync.Mutex
+
+	// mu protects calls.
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+	// sem limits the number of calls in progress.
+	sem chan struct{}
+}
+
+// start records a call, returning false if a call with the same ID
+// is already in progress.
+func (c *wsServerConn) start(id string, cancel context.CancelFunc) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.calls[id]; ok {
+		return false
+	}
+	c.calls[id] = cancel
+	return true
+}
+
+// cancel cancels the call, if it is in progress.
+func (c *wsServerConn) cancel(id string) {
+	c.mu.Lock()
+	cancel, ok := c.calls[id]
+	delete(c.calls, id)
+	c.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// send writes a message to the client.
+func (c *wsServerConn) send(msg WebSocketMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// sendErr writes an error to the client as the last message of the call.
+func (c *wsServerConn) sendErr(id string, err error) {
+	resp := NewErrorResponse(err)
+	payload, _ := json.Marshal([]ErrorResponse{resp})
+	// nothing more can be done if this fails
+	_ = c.send(WebSocketMessage{
+		ID:      id,
+		Status:  HTTPStatus(resp.ErrorCode),
+		Payload: payload,
+		Done:    true,
+	})
+}
+
+// wsResponseWriter is the http.ResponseWriter for a call made over a
+// WebSocket connection. The body is sent as a single message when the
+// call has finished, except for streaming methods (see StreamWriter)
+// which send a message for each response as it is flushed.
+type wsResponseWriter struct {
+	id     string
+	conn   *wsServerConn
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	// metadata is the response metadata from the headers, when they
+	// were written, until it has been sent.
+	metadata Metadata
+}
+
+func (w *wsResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.metadata = metadataFromHeader(w.header)
+	}
+}
+
+func (w *wsResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(b)
+}
+
+// Flush sends each complete response written by a streaming method.
+func (w *wsResponseWriter) Flush() {
+	if !w.streaming() {
+		return
+	}
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i == -1 {
+			return
+		}
+		line := w.buf.Next(i + 1)
+		if err := w.conn.send(WebSocketMessage{ID: w.id, Status: w.status, Payload: line[:i], Metadata: w.takeMetadata(nil)}); err != nil {
+			return
+		}
+	}
+}
+
+// finish sends the rest of the body, as the last message of the call.
+func (w *wsResponseWriter) finish() {
+	w.WriteHeader(http.StatusOK)
+	// metadata set after the response started is sent last, like
+	// trailers
+	trailers := metadataFromTrailers(w.header)
+	if w.streaming() {
+		w.Flush()
+		_ = w.conn.send(WebSocketMessage{ID: w.id, Status: w.status, Metadata: w.takeMetadata(trailers), Done: true})
+		return
+	}
+	payload := w.buf.Bytes()
+	if !strings.HasPrefix(w.header.Get("Content-Type"), "application/json") || !json.Valid(payload) {
+		w.conn.sendErr(w.id, Errorf(CodeUnimplemented, "response cannot be sent over a websocket connection (%s)", w.header.Get("Content-Type")))
+		return
+	}
+	_ = w.conn.send(WebSocketMessage{ID: w.id, Status: w.status, Payload: payload, Metadata: w.takeMetadata(trailers), Done: true})
+}
+
+// takeMetadata gets the response metadata from the headers, if it has
+// not already been sent, with the extra metadata added.
+func (w *wsResponseWriter) takeMetadata(extra Metadata) Metadata {
+	md := w.metadata
+	w.metadata = nil
+	for k, v := range extra {
+		if md == nil {
+			md = make(Metadata)
+		}
+		md[k] = v
+	}
+	return md
+}
+
+// streaming gets whether the response is from a streaming method.
+func (w *wsResponseWriter) streaming() bool {
+	return strings.HasPrefix(w.header.Get("Content-Type"), "application/x-ndjson")
+}
+
+// ErrWebSocketClosed is returned for calls made with a closed
+// WebSocketTransport.
+var ErrWebSocketClosed = errors.New("remotohttp: websocket transport closed")
+
+// WebSocketTransport is an http.RoundTripper that sends calls over a
+// single WebSocket connection to a Server (see ServeWebSocket), so
+// generated clients can use it instead of making HTTP requests.
+//
+//	transport, err := remotohttp.DialWebSocket(ctx, "ws://localhost:8080"+remotohttp.WebSocketPath, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer transport.Close()
+//	client := greeter.NewGreeterClient("http://localhost:8080", &http.Client{Transport: transport})
+//
+// The service and method are taken from the path of each request, and
+// the requests from its body. Files are not supported.
+type WebSocketTransport struct {
+	conn   *websocket.Conn
+	nextID uint64
+	// writeMu serializes writes to conn.
+	writeMu sync.Mutex
+	// closed is closed when the connection has been closed.
+	closed chan struct{}
+
+	// mu protects calls, closing and err.
+	mu      sync.Mutex
+	calls   map[string]*wsCall
+	closing bool
+	err     error
+}
+
+// DialWebSocket connects to the WebSocket endpoint of a Server at url
+// (e.g. ws://localhost:8080/remoto/websocket). The header is sent with
+// the upgrade request, and may be nil.
+func DialWebSocket(ctx context.Context, url string, header http.Header) (*WebSocketTransport, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial websocket")
+	}
+	t := &WebSocketTransport{
+		conn:   conn,
+		closed: make(chan struct{}),
+		calls:  make(map[string]*wsCall),
+	}
+	go t.read()
+	return t, nil
+}
+
+// RoundTrip makes the call described by req over the connection.
+func (t *WebSocketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	payload, err := requestPayload(req)
+	if err != nil {
+		return nil, err
+	}
+	service, method := parsePath(req.URL.Path)
+	id := strconv.FormatUint(atomic.AddUint64(&t.nextID, 1), 10)
+	call := &wsCall{
+		started: make(chan struct{}),
+		header:  http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		trailer: make(http.Header),
+		body:    newWSBody(func() { t.cancel(id) }),
+	}
+	t.mu.Lock()
+	if t.err != nil {
+		err := t.err
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.calls[id] = call
+	t.mu.Unlock()
+	msg := WebSocketMessage{
+		ID:       id,
+		Service:  service,
+		Method:   method,
+		Payload:  payload,
+		Metadata: metadataFromHeader(req.Header),
+	}
+	if err := t.send(msg); err != nil {
+		t.cancel(id)
+		return nil, errors.Wrap(err, "send")
+	}
+	ctx := req.Context()
+	select {
+	case <-call.started:
+	case <-ctx.Done():
+		t.cancel(id)
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	go func() {
+		// cancel the call if ctx is done before it finishes
+		select {
+		case <-ctx.Done():
+			call.body.finish(ctx.Err())
+			t.cancel(id)
+		case <-call.body.done:
+		}
+	}()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", call.status, http.StatusText(call.status)),
+		StatusCode:    call.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        call.header,
+		Trailer:       call.trailer,
+		Body:          call.body,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// Close closes the connection. Calls in progress fail with
+// ErrWebSocketClosed.
+func (t *WebSocketTransport) Close() error {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+	t.writeMu.Lock()
+	_ = t.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	t.writeMu.Unlock()
+	err := t.conn.Close()
+	<-t.closed
+	return err
+}
+
+// read reads messages from the connection, and passes them to the
+// calls they belong to, until the connection is closed.
+func (t *WebSocketTransport) read() {
+	defer close(t.closed)
+	var err error
+	for {
+		var msg WebSocketMessage
+		if err = t.conn.ReadJSON(&msg); err != nil {
+			break
+		}
+		t.mu.Lock()
+		call, ok := t.calls[msg.ID]
+		if ok && msg.Done {
+			delete(t.calls, msg.ID)
+		}
+		t.mu.Unlock()
+		if !ok {
+			continue // cancelled
+		}
+		call.receive(msg)
+	}
+	t.mu.Lock()
+	if t.closing {
+		err = ErrWebSocketClosed
+	} else {
+		err = errors.Wrap(err, "websocket")
+	}
+	t.err = err
+	calls := t.calls
+	t.calls = nil
+	t.mu.Unlock()
+	for _, call := range calls {
+		call.fail(err)
+	}
+}
+
+// send writes a message to the server.
+func (t *WebSocketTransport) send(msg WebSocketMessage) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.conn.WriteJSON(msg)
+}
+
+// cancel tells the server to cancel the call, if it is in progress.
+func (t *WebSocketTransport) cancel(id string) {
+	t.mu.Lock()
+	_, ok := t.calls[id]
+	delete(t.calls, id)
+	t.mu.Unlock()
+	if ok {
+		_ = t.send(WebSocketMessage{ID: id, Cancel: true})
+	}
+}
+
+// requestPayload gets the JSON array of requests from the body of req,
+// which is encoded like requests to ServeHTTP (see Decode).
+func requestPayload(req *http.Request) (json.RawMessage, error) {
+	if req.Body == nil {
+		return nil, errors.New("websocket: missing request body")
+	}
+	defer req.Body.Close()
+	contentType := strings.ToLower(req.Header.Get("Content-Type"))
+	switch {
+	case strings.Contains(contentType, "application/json"):
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "read request body")
+		}
+		return b, nil
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"),
+		strings.Contains(contentType, "multipart/form-data"):
+		if err := req.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return nil, errors.Wrap(err, "parse request body")
+		}
+		if req.MultipartForm != nil && len(req.MultipartForm.File) > 0 {
+			return nil, errors.New("websocket: files are not supported")
+		}
+		return json.RawMessage(req.PostForm.Get("json")), nil
+	}
+	return nil, errors.Errorf("websocket: unsupported Content-Type %q", contentType)
+}
+
+// wsCall is a call in progress on a WebSocketTransport.
+type wsCall struct {
+	// started is closed when the first message is received, or the
+	// call fails.
+	started chan struct{}
+	start   sync.Once
+	status  int
+	err     error
+	// header and trailer get the response metadata from the first
+	// and last messages.
+	header  http.Header
+	trailer http.Header
+	body    *wsBody
+}
+
+// receive handles a message from the server.
+func (c *wsCall) receive(msg WebSocketMessage) {
+	first := false
+	c.start.Do(func() {
+		c.status = msg.Status
+		setMetadata(c.header, msg.Metadata)
+		first = true
+		close(c.started)
+	})
+	if len(msg.Payload) > 0 {
+		c.body.write(append(msg.Payload, '\n'))
+	}
+	if msg.Done {
+		if !first {
+			setMetadata(c.trailer, msg.Metadata)
+		}
+		c.body.finish(io.EOF)
+	}
+}
+
+// fail stops the call with err.
+func (c *wsCall) fail(err error) {
+	c.start.Do(func() {
+		c.err = err
+		close(c.started)
+	})
+	c.body.finish(err)
+}
+
+// wsBody is the body of a response from a WebSocketTransport. The
+// payloads of the messages received for the call are written to it.
+type wsBody struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     bytes.Buffer
+	err     error
+	done    chan struct{}
+	onClose func()
+}
+
+func newWSBody(onClose func()) *wsBody {
+	b := &wsBody{
+		done:    make(chan struct{}),
+		onClose: onClose,
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// write adds p to the body.
+func (b *wsBody) write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
+	}
+	b.buf.Write(p)
+	b.cond.Broadcast()
+}
+
+// finish ends the body. Read returns err once the body has been read.
+func (b *wsBody) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
+	}
+	b.err = err
+	close(b.done)
+	b.cond.Broadcast()
+}
+
+func (b *wsBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.buf.Len() == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.buf.Len() > 0 {
+		return b.buf.Read(p)
+	}
+	return 0, b.err
+}
+
+// Close closes the body, cancelling the call if it has not finished.
+func (b *wsBody) Close() error {
+	b.finish(errors.New("read on closed response body"))
+	b.onClose()
+	return nil
+}
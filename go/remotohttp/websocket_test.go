@@ -0,0 +1,192 @@
+package remotohttp_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matryer/remoto/go/remotohttp"
+)
+
+// newWebSocketServer starts a test server with a Greeter.Greet method,
+// and a Watcher.Watch streaming method that sends responses until it
+// is cancelled, closing stopped when it is.
+func newWebSocketServer(t *testing.T, stopped chan struct{}) (*remotohttp.Server, *httptest.Server) {
+	type greetRequest struct {
+		Name string `json:"name"`
+	}
+	type greetResponse struct {
+		Greeting string `json:"greeting"`
+	}
+	type watchResponse struct {
+		Change int `json:"change"`
+	}
+	srv := &remotohttp.Server{}
+	srv.Register("/remoto/Greeter.Greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []greetRequest
+		if err := remotohttp.Decode(r, &reqs); err != nil {
+			srv.HandleErr(w, r, err)
+			return
+		}
+		resps := make([]greetResponse, len(reqs))
+		for i := range reqs {
+			resps[i].Greeting = "Hello " + reqs[i].Name
+		}
+		if err := remotohttp.Encode(w, r, http.StatusOK, resps); err != nil {
+			t.Error(err)
+		}
+	}))
+	srv.Register("/remoto/Watcher.Watch", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := remotohttp.NewStreamWriter(w)
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				close(stopped)
+				return
+			case <-time.After(time.Millisecond):
+			}
+			if err := stream.Send(watchResponse{Change: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+	s := httptest.NewServer(http.HandlerFunc(srv.ServeWebSocket))
+	return srv, s
+}
+
+func TestWebSocket(t *testing.T) {
+	is := is.New(t)
+	srv, s := newWebSocketServer(t, make(chan struct{}))
+	defer s.Close()
+	var (
+		lock           sync.Mutex
+		authorizations []string
+	)
+	srv.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+			lock.Unlock()
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+	header := http.Header{"Authorization": []string{"Bearer token"}}
+	transport, err := remotohttp.DialWebSocket(ctx, "ws"+strings.TrimPrefix(s.URL, "http"), header)
+	is.NoErr(err)
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			is := is.New(t)
+			body := fmt.Sprintf(`[{"name":"%d"}]`, i)
+			resp, err := client.Post("http://remoto/remoto/Greeter.Greet", "application/json", strings.NewReader(body))
+			is.NoErr(err)
+			defer resp.Body.Close()
+			is.Equal(resp.StatusCode, http.StatusOK)
+			b, err := ioutil.ReadAll(resp.Body)
+			is.NoErr(err)
+			is.Equal(strings.TrimSpace(string(b)), fmt.Sprintf(`[{"greeting":"Hello %d"}]`, i))
+		}(i)
+	}
+	wg.Wait()
+	is.Equal(len(authorizations), 10)
+	is.Equal(authorizations[0], "Bearer token") // headers should be passed to middleware
+
+	resp, err := client.Post("http://remoto/remoto/Greeter.Nope", "application/json", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusNotFound)
+	e := remotohttp.AsError(remotohttp.ResponseErr(resp))
+	is.True(e != nil)
+	is.Equal(e.Code, remotohttp.CodeNotFound)
+}
+
+func TestWebSocketStream(t *testing.T) {
+	is := is.New(t)
+	stopped := make(chan struct{})
+	_, s := newWebSocketServer(t, stopped)
+	defer s.Close()
+	ctx := context.Background()
+	transport, err := remotohttp.DialWebSocket(ctx, "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	resp, err := client.Post("http://remoto/remoto/Watcher.Watch", "application/json", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	dec := remotohttp.NewStreamDecoder(resp.Body)
+	for i := 0; i < 3; i++ {
+		is.True(dec.More())
+		var watchResp struct {
+			Change int `json:"change"`
+		}
+		is.NoErr(dec.Decode(&watchResp))
+		is.Equal(watchResp.Change, i)
+	}
+	is.NoErr(dec.Close())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		is.Fail() // closing the body should cancel the call
+	}
+}
+
+func TestWebSocketTransportClose(t *testing.T) {
+	is := is.New(t)
+	_, s := newWebSocketServer(t, make(chan struct{}))
+	defer s.Close()
+	transport, err := remotohttp.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	is.NoErr(transport.Close())
+	client := &http.Client{Transport: transport}
+	_, err = client.Post("http://remoto/remoto/Greeter.Greet", "application/json", strings.NewReader(`[{}]`))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), remotohttp.ErrWebSocketClosed.Error()))
+}
+
+func TestWebSocketConcurrency(t *testing.T) {
+	is := is.New(t)
+	srv, s := newWebSocketServer(t, make(chan struct{}))
+	defer s.Close()
+	srv.Concurrency = 1
+	transport, err := remotohttp.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	stream, err := client.Post("http://remoto/remoto/Watcher.Watch", "application/json", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	// the stream is in progress, so there is no room for another call
+	resp, err := client.Post("http://remoto/remoto/Greeter.Greet", "application/json", strings.NewReader(`[{}]`))
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusTooManyRequests)
+	is.Equal(remotohttp.AsError(remotohttp.ResponseErr(resp)).Code, remotohttp.CodeResourceExhausted)
+	is.NoErr(stream.Body.Close())
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	is := is.New(t)
+	srv, s := newWebSocketServer(t, make(chan struct{}))
+	defer s.Close()
+	srv.MaxBodyBytes = 1024
+	transport, err := remotohttp.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	is.NoErr(err)
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	body := `[{"name":"` + strings.Repeat("x", 2048) + `"}]`
+	_, err = client.Post("http://remoto/remoto/Greeter.Greet", "application/json", strings.NewReader(body))
+	is.True(err != nil) // the connection is closed
+}
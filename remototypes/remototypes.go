@@ -1,8 +1,9 @@
 package remototypes
 
 // File describes a binary file.
-// This type is only allowed in requests, for responses RPC methods should
-// return a FileResponse.
+// Files may be uploaded in requests, or returned in the fields of a
+// response object (but not in structures nested inside it). RPC methods
+// that return a single file should return a FileResponse.
 type File struct{}
 
 // FileResponse is response type for a file.